@@ -36,7 +36,7 @@ func (c *ListAutoScaleHistoryCmd) Run(ctx *cmd.Context, client *cmd.Client) erro
 	}
 	limit := 20
 	skip := (c.page - 1) * limit
-	u, err := cmd.GetURLVersion("1.3", fmt.Sprintf("/node/autoscale?skip=%d&limit=%d", skip, limit))
+	u, err := client.URLVersion(fmt.Sprintf("/node/autoscale?skip=%d&limit=%d", skip, limit), "1.3", "1.0")
 	if err != nil {
 		return err
 	}
@@ -113,7 +113,7 @@ func (c *AutoScaleRunCmd) Run(context *cmd.Context, client *cmd.Client) error {
 	if !c.Confirm(context, "Are you sure you want to run auto scaling checks?") {
 		return nil
 	}
-	u, err := cmd.GetURLVersion("1.3", "/node/autoscale/run")
+	u, err := client.URLVersion("/node/autoscale/run", "1.3", "1.0")
 	if err != nil {
 		return err
 	}
@@ -170,7 +170,7 @@ func (c *AutoScaleInfoCmd) Run(context *cmd.Context, client *cmd.Client) error {
 }
 
 func (c *AutoScaleInfoCmd) getAutoScaleConfig(client *cmd.Client) (*autoscale.Config, error) {
-	u, err := cmd.GetURLVersion("1.3", "/node/autoscale/config")
+	u, err := client.URLVersion("/node/autoscale/config", "1.3", "1.0")
 	if err != nil {
 		return nil, err
 	}
@@ -192,7 +192,7 @@ func (c *AutoScaleInfoCmd) getAutoScaleConfig(client *cmd.Client) (*autoscale.Co
 }
 
 func (c *AutoScaleInfoCmd) getAutoScaleRules(client *cmd.Client) ([]autoscale.Rule, error) {
-	u, err := cmd.GetURLVersion("1.3", "/node/autoscale/rules")
+	u, err := client.URLVersion("/node/autoscale/rules", "1.3", "1.0")
 	if err != nil {
 		return nil, err
 	}
@@ -274,7 +274,7 @@ func (c *AutoScaleSetRuleCmd) Run(context *cmd.Context, client *cmd.Client) erro
 		return err
 	}
 	body := strings.NewReader(val.Encode())
-	u, err := cmd.GetURLVersion("1.3", "/node/autoscale/rules")
+	u, err := client.URLVersion("/node/autoscale/rules", "1.3", "1.0")
 	if err != nil {
 		return err
 	}
@@ -338,7 +338,7 @@ func (c *AutoScaleDeleteRuleCmd) Run(context *cmd.Context, client *cmd.Client) e
 	if !c.Confirm(context, confirmMsg) {
 		return nil
 	}
-	u, err := cmd.GetURLVersion("1.3", "/node/autoscale/rules/"+rule)
+	u, err := client.URLVersion("/node/autoscale/rules/"+rule, "1.3", "1.0")
 	if err != nil {
 		return err
 	}
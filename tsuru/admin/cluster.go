@@ -63,7 +63,7 @@ func (c *ClusterUpdate) Info() *cmd.Info {
 }
 
 func (c *ClusterUpdate) Run(context *cmd.Context, client *cmd.Client) error {
-	u, err := cmd.GetURLVersion("1.3", "/provisioner/clusters")
+	u, err := client.URLVersion("/provisioner/clusters", "1.3", "1.0")
 	if err != nil {
 		return err
 	}
@@ -129,7 +129,7 @@ func (c *ClusterList) Info() *cmd.Info {
 }
 
 func (c *ClusterList) Run(context *cmd.Context, client *cmd.Client) error {
-	u, err := cmd.GetURLVersion("1.3", "/provisioner/clusters")
+	u, err := client.URLVersion("/provisioner/clusters", "1.3", "1.0")
 	if err != nil {
 		return err
 	}
@@ -186,7 +186,7 @@ func (c *ClusterRemove) Info() *cmd.Info {
 
 func (c *ClusterRemove) Run(context *cmd.Context, client *cmd.Client) error {
 	name := context.Args[0]
-	u, err := cmd.GetURLVersion("1.3", "/provisioner/clusters/"+name)
+	u, err := client.URLVersion("/provisioner/clusters/"+name, "1.3", "1.0")
 	if err != nil {
 		return err
 	}
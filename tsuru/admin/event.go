@@ -44,7 +44,7 @@ func (c *EventBlockList) Run(context *cmd.Context, client *cmd.Client) error {
 	if c.active {
 		path += "?active=true"
 	}
-	url, err := cmd.GetURLVersion("1.3", path)
+	url, err := client.URLVersion(path, "1.3", "1.0")
 	if err != nil {
 		return err
 	}
@@ -127,7 +127,7 @@ func (c *EventBlockAdd) Flags() *gnuflag.FlagSet {
 }
 
 func (c *EventBlockAdd) Run(context *cmd.Context, client *cmd.Client) error {
-	url, err := cmd.GetURLVersion("1.3", "/events/blocks")
+	url, err := client.URLVersion("/events/blocks", "1.3", "1.0")
 	if err != nil {
 		return err
 	}
@@ -172,7 +172,7 @@ func (c *EventBlockRemove) Info() *cmd.Info {
 
 func (c *EventBlockRemove) Run(context *cmd.Context, client *cmd.Client) error {
 	uuid := context.Args[0]
-	url, err := cmd.GetURLVersion("1.3", fmt.Sprintf("/events/blocks/%s", uuid))
+	url, err := client.URLVersion(fmt.Sprintf("/events/blocks/%s", uuid), "1.3", "1.0")
 	if err != nil {
 		return err
 	}
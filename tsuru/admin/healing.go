@@ -80,7 +80,7 @@ func (c *ListHealingHistoryCmd) Run(ctx *cmd.Context, client *cmd.Client) error
 	if c.containerOnly && !c.nodeOnly {
 		filter = "container"
 	}
-	url, err := cmd.GetURLVersion("1.3", fmt.Sprintf("/healing?filter=%s", filter))
+	url, err := client.URLVersion(fmt.Sprintf("/healing?filter=%s", filter), "1.3")
 	if err != nil {
 		return err
 	}
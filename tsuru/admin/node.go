@@ -104,7 +104,7 @@ func (a *AddNodeCmd) Run(ctx *cmd.Context, client *cmd.Client) error {
 	if err != nil {
 		return err
 	}
-	u, err := cmd.GetURLVersion("1.2", "/node")
+	u, err := client.URLVersion("/node", "1.2", "1.0")
 	if err != nil {
 		return err
 	}
@@ -177,7 +177,7 @@ func (a *UpdateNodeCmd) Run(ctx *cmd.Context, client *cmd.Client) error {
 			opts.Metadata[keyValue[0]] = keyValue[1]
 		}
 	}
-	u, err := cmd.GetURLVersion("1.2", "/node")
+	u, err := client.URLVersion("/node", "1.2", "1.0")
 	if err != nil {
 		return err
 	}
@@ -235,7 +235,7 @@ func (c *RemoveNodeCmd) Run(ctx *cmd.Context, client *cmd.Client) error {
 		v.Set("remove-iaas", "true")
 	}
 	v.Set("no-rebalance", strconv.FormatBool(c.noRebalance))
-	u, err := cmd.GetURLVersion("1.2", fmt.Sprintf("/node/%s?%s", address, v.Encode()))
+	u, err := client.URLVersion(fmt.Sprintf("/node/%s?%s", address, v.Encode()), "1.2", "1.0")
 	if err != nil {
 		return err
 	}
@@ -292,7 +292,7 @@ func (c *ListNodesCmd) Flags() *gnuflag.FlagSet {
 }
 
 func (c *ListNodesCmd) Run(ctx *cmd.Context, client *cmd.Client) error {
-	u, err := cmd.GetURLVersion("1.2", "/node")
+	u, err := client.URLVersion("/node", "1.2", "1.0")
 	if err != nil {
 		return err
 	}
@@ -395,7 +395,7 @@ func (c *GetNodeHealingConfigCmd) Info() *cmd.Info {
 }
 
 func (c *GetNodeHealingConfigCmd) Run(ctx *cmd.Context, client *cmd.Client) error {
-	u, err := cmd.GetURLVersion("1.2", "/healing/node")
+	u, err := client.URLVersion("/healing/node", "1.2", "1.0")
 	if err != nil {
 		return err
 	}
@@ -502,7 +502,7 @@ func (c *SetNodeHealingConfigCmd) Run(ctx *cmd.Context, client *cmd.Client) erro
 		v.Set("Enabled", strconv.FormatBool(false))
 	}
 	body := strings.NewReader(v.Encode())
-	u, err := cmd.GetURLVersion("1.2", "/healing/node")
+	u, err := client.URLVersion("/healing/node", "1.2", "1.0")
 	if err != nil {
 		return err
 	}
@@ -575,7 +575,7 @@ func (c *DeleteNodeHealingConfigCmd) Run(ctx *cmd.Context, client *cmd.Client) e
 	if c.maxUnsuccessful {
 		v.Add("name", "MaxTimeSinceSuccess")
 	}
-	u, err := cmd.GetURLVersion("1.2", "/healing/node?"+v.Encode())
+	u, err := client.URLVersion("/healing/node?"+v.Encode(), "1.2", "1.0")
 	if err != nil {
 		return err
 	}
@@ -618,7 +618,7 @@ func (c *RebalanceNodeCmd) Run(context *cmd.Context, client *cmd.Client) error {
 	if !c.dry && !c.Confirm(context, "Are you sure you want to rebalance containers?") {
 		return nil
 	}
-	u, err := cmd.GetURLVersion("1.3", "/node/rebalance")
+	u, err := client.URLVersion("/node/rebalance", "1.3", "1.0")
 	if err != nil {
 		return err
 	}
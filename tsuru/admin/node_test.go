@@ -8,7 +8,9 @@ import (
 	"bytes"
 	"encoding/json"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
 	"strings"
 
 	"github.com/ajg/form"
@@ -223,6 +225,45 @@ func (s *S) TestListNodesCmdRun(c *check.C) {
 	c.Assert(buf.String(), check.Equals, expected)
 }
 
+func (s *S) TestListNodesCmdRunNegotiatesAPIVersion(c *check.C) {
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", c.MkDir())
+	os.Unsetenv("TSURU_API_VERSION")
+	defer os.Setenv("TSURU_API_VERSION", "1.3")
+	defer os.Setenv("TSURU_TARGET", os.Getenv("TSURU_TARGET"))
+	tests := []struct {
+		info     int
+		version  string
+		expected string
+	}{
+		{http.StatusOK, "1.4.0", "/1.2/node"},
+		{http.StatusOK, "1.1.3", "/1.0/node"},
+		{http.StatusNotFound, "", "/1.2/node"},
+		{http.StatusInternalServerError, "", "/1.2/node"},
+	}
+	for _, t := range tests {
+		var paths []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			paths = append(paths, r.URL.Path)
+			if r.URL.Path == "/1.0/info" {
+				w.WriteHeader(t.info)
+				w.Write([]byte(`{"version":"` + t.version + `"}`))
+				return
+			}
+			w.Write([]byte(`{"nodes":[]}`))
+		}))
+		os.Setenv("TSURU_TARGET", server.URL)
+		client := cmd.NewClient(&http.Client{}, nil, &cmd.Manager{})
+		for i := 0; i < 2; i++ {
+			context := cmd.Context{Args: []string{}, Stdout: new(bytes.Buffer), Stderr: new(bytes.Buffer)}
+			err := (&ListNodesCmd{}).Run(&context, client)
+			c.Assert(err, check.IsNil)
+		}
+		server.Close()
+		c.Check(paths, check.DeepEquals, []string{"/1.0/info", t.expected, t.expected}, check.Commentf("%d %s", t.info, t.version))
+	}
+}
+
 func (s *S) TestListNodesCmdRunWithFilters(c *check.C) {
 	var buf bytes.Buffer
 	context := cmd.Context{Args: []string{}, Stdout: &buf}
@@ -276,6 +276,9 @@ func doRequest(client *cmd.Client, url, method, body string) error {
 }
 
 func confirmAction(ctx *cmd.Context, client *cmd.Client, url, method, body string, retryMessage, failMessage, successMessage string) error {
+	if err := ctx.CheckInteractive(fmt.Sprintf(retryMessage, ctx.Args[0]), "--force"); err != nil {
+		return err
+	}
 	var answer string
 	fmt.Fprintf(ctx.Stdout, retryMessage, ctx.Args[0])
 	fmt.Fscanf(ctx.Stdin, "%s", &answer)
@@ -303,7 +306,7 @@ func (c *PoolConstraintList) Info() *cmd.Info {
 }
 
 func (c *PoolConstraintList) Run(ctx *cmd.Context, client *cmd.Client) error {
-	url, err := cmd.GetURLVersion("1.3", "/constraints")
+	url, err := client.URLVersion("/constraints", "1.3")
 	if err != nil {
 		return err
 	}
@@ -363,7 +366,7 @@ Examples:
 }
 
 func (c *PoolConstraintSet) Run(ctx *cmd.Context, client *cmd.Client) error {
-	u, err := cmd.GetURLVersion("1.3", "/constraints")
+	u, err := client.URLVersion("/constraints", "1.3")
 	if err != nil {
 		return err
 	}
@@ -76,7 +76,7 @@ func (*UserChangeQuota) Run(context *cmd.Context, client *cmd.Client) error {
 	v.Set("limit", limit)
 	request, _ := http.NewRequest("PUT", u, bytes.NewBufferString(v.Encode()))
 	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	_, err = client.Do(request)
+	_, err = client.Do(cmd.Idempotent(request))
 	if err != nil {
 		return err
 	}
@@ -143,7 +143,7 @@ func (AppQuotaChange) Run(context *cmd.Context, client *cmd.Client) error {
 	v.Set("limit", limit)
 	request, _ := http.NewRequest("PUT", u, bytes.NewBufferString(v.Encode()))
 	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	_, err = client.Do(request)
+	_, err = client.Do(cmd.Idempotent(request))
 	if err != nil {
 		return err
 	}
@@ -21,10 +21,12 @@ func (s *S) SetUpSuite(c *check.C) {
 	var stdout, stderr bytes.Buffer
 	s.manager = cmd.NewManager("glb", "1.0.0", "Supported-Tsuru-Version", &stdout, &stderr, os.Stdin, nil)
 	os.Setenv("TSURU_TARGET", "http://localhost")
+	os.Setenv("TSURU_API_VERSION", "1.3")
 }
 
 func (s *S) TearDownSuite(c *check.C) {
 	os.Unsetenv("TSURU_TARGET")
+	os.Unsetenv("TSURU_API_VERSION")
 }
 
 var _ = check.Suite(&S{})
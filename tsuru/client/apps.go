@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"net/http"
@@ -382,75 +383,71 @@ func (c *AppRemove) Flags() *gnuflag.FlagSet {
 
 type AppInfo struct {
 	cmd.GuessingCommand
+	byNode       bool
+	maxShare     float64
+	nodeMetadata cmd.StringSliceFlag
+	fs           *gnuflag.FlagSet
 }
 
 func (c *AppInfo) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:  "app-info",
-		Usage: "app-info [-a/--app appname]",
+		Usage: "app-info [-a/--app appname] [--by-node [--max-share percentage] [--node-metadata key]...]",
 		Desc: `Shows information about a specific app. Its state, platform, git repository,
 etc. You need to be a member of a team that has access to the app to be able to
-see information about it.`,
+see information about it.
+
+Use [[--by-node]] to show how the units of the app are distributed across the
+hosts, with the number of units of each process in each host. Hosts holding
+more than [[--max-share]] percent of the units of a process with more than one
+unit are reported. The [[--node-metadata]] flag, which may be used multiple
+times, adds the given metadata of the nodes (e.g. pool or zone) to the
+distribution. Listing the nodes requires administrative permissions.`,
 		MinArgs: 0,
 	}
 }
 
+func (c *AppInfo) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = c.GuessingCommand.Flags()
+		c.fs.BoolVar(&c.byNode, "by-node", false, "Show the distribution of the units across the hosts")
+		c.fs.Float64Var(&c.maxShare, "max-share", 50, "Report hosts holding more than this percentage of the units of a process")
+		c.fs.Var(&c.nodeMetadata, "node-metadata", "Node metadata to show along with the distribution, may be used multiple times")
+	}
+	return c.fs
+}
+
 func (c *AppInfo) Run(context *cmd.Context, client *cmd.Client) error {
 	appName, err := c.Guess()
 	if err != nil {
 		return err
 	}
-	u, err := cmd.GetURL(fmt.Sprintf("/apps/%s", appName))
-	if err != nil {
-		return err
-	}
-	request, err := http.NewRequest("GET", u, nil)
-	if err != nil {
-		return err
-	}
-	response, err := client.Do(request)
-	if err != nil {
-		return err
+	if c.byNode {
+		return c.showByNode(context, client, appName)
 	}
-	if response.StatusCode == http.StatusNoContent {
-		return nil
-	}
-	defer response.Body.Close()
-	result, err := ioutil.ReadAll(response.Body)
-	if err != nil {
-		return err
-	}
-	u, err = cmd.GetURL(fmt.Sprintf("/services/instances?app=%s", appName))
-	if err != nil {
-		return err
-	}
-	request, err = http.NewRequest("GET", u, nil)
-	if err != nil {
-		return err
-	}
-	response, err = client.Do(request)
-	var servicesResult []byte
-	if err == nil {
-		defer response.Body.Close()
-		servicesResult, err = ioutil.ReadAll(response.Body)
-		if err != nil {
+	var result, servicesResult, quota []byte
+	err = fetchAll(client,
+		func() error {
+			var err error
+			result, err = getFromURL(fmt.Sprintf("/apps/%s", appName), client)
 			return err
-		}
-	}
-	var quota []byte
-	u, err = cmd.GetURL("/apps/" + appName + "/quota")
-	if err != nil {
-		return err
-	}
-	request, _ = http.NewRequest("GET", u, nil)
-	response, err = client.Do(request)
+		},
+		func() error {
+			// The app is shown even if its service instances can't be listed.
+			servicesResult, _ = getFromURL(fmt.Sprintf("/services/instances?app=%s", appName), client)
+			return nil
+		},
+		func() error {
+			var err error
+			quota, err = getFromURL("/apps/"+appName+"/quota", client)
+			return err
+		},
+	)
 	if err != nil {
 		return err
 	}
-	defer response.Body.Close()
-	quota, err = ioutil.ReadAll(response.Body)
-	if err != nil {
-		return err
+	if len(result) == 0 {
+		return nil
 	}
 	return c.Show(result, servicesResult, quota, context)
 }
@@ -557,6 +554,32 @@ func (a *app) GetRouterOpts() string {
 	return strings.Join(kv, ", ")
 }
 
+// processUnits returns the units of the app grouped by process name,
+// ignoring placeholder units without an ID.
+func (a *app) processUnits() map[string][]unit {
+	result := map[string][]unit{}
+	for _, u := range a.Units {
+		if u.ID == "" {
+			continue
+		}
+		result[u.ProcessName] = append(result[u.ProcessName], u)
+	}
+	return result
+}
+
+func loadApp(client *cmd.Client, appName string) (*app, error) {
+	result, err := getFromURL("/apps/"+appName, client)
+	if err != nil {
+		return nil, err
+	}
+	var a app
+	err = json.Unmarshal(result, &a)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
 func shortID(id string) string {
 	if hexRegex.MatchString(id) && len(id) > cutoffHexID {
 		return id[:cutoffHexID]
@@ -688,7 +711,7 @@ func (c *AppGrant) Run(context *cmd.Context, client *cmd.Client) error {
 	if err != nil {
 		return err
 	}
-	_, err = client.Do(request)
+	_, err = client.Do(cmd.Idempotent(request))
 	if err != nil {
 		return err
 	}
@@ -727,7 +750,7 @@ func (c *AppRevoke) Run(context *cmd.Context, client *cmd.Client) error {
 	if err != nil {
 		return err
 	}
-	_, err = client.Do(request)
+	_, err = client.Do(cmd.Idempotent(request))
 	if err != nil {
 		return err
 	}
@@ -902,40 +925,35 @@ Flags can be used to filter the list of applications.`,
 
 type AppStop struct {
 	cmd.GuessingCommand
-	process string
-	fs      *gnuflag.FlagSet
+	process  string
+	selector appSelector
+	fs       *gnuflag.FlagSet
 }
 
 func (c *AppStop) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:    "app-stop",
-		Usage:   "app-stop [-a/--app appname] [-p/--process processname]",
-		Desc:    "Stops an application, or one of the processes of the application.",
+		Usage:   "app-stop [-a/--app appname] [-p/--process processname] [app filters]",
+		Desc:    "Stops an application, or one of the processes of the application." + appSelectorHelp,
 		MinArgs: 0,
 	}
 }
 
 func (c *AppStop) Run(context *cmd.Context, client *cmd.Client) error {
 	context.RawOutput()
-	appName, err := c.Guess()
-	if err != nil {
+	if err := c.selector.checkSingleApp(c.Flags()); err != nil {
 		return err
 	}
-	u, err := cmd.GetURL(fmt.Sprintf("/apps/%s/stop", appName))
-	if err != nil {
-		return err
-	}
-	body := strings.NewReader("process=" + c.process)
-	request, err := http.NewRequest("POST", u, body)
-	if err != nil {
-		return err
+	if c.selector.active() {
+		return c.selector.run(context, client, "stop", func(ctx *cmd.Context, appName string) error {
+			return appProcessAction(ctx, client, appName, "stop", c.process)
+		})
 	}
-	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	response, err := client.Do(request)
+	appName, err := c.Guess()
 	if err != nil {
 		return err
 	}
-	return cmd.StreamJSONResponse(context.Stdout, response)
+	return appProcessAction(context, client, appName, "stop", c.process)
 }
 
 func (c *AppStop) Flags() *gnuflag.FlagSet {
@@ -943,46 +961,42 @@ func (c *AppStop) Flags() *gnuflag.FlagSet {
 		c.fs = c.GuessingCommand.Flags()
 		c.fs.StringVar(&c.process, "process", "", "Process name")
 		c.fs.StringVar(&c.process, "p", "", "Process name")
+		c.fs = c.selector.flags(c.fs)
 	}
 	return c.fs
 }
 
 type AppStart struct {
 	cmd.GuessingCommand
-	process string
-	fs      *gnuflag.FlagSet
+	process  string
+	selector appSelector
+	fs       *gnuflag.FlagSet
 }
 
 func (c *AppStart) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:    "app-start",
-		Usage:   "app-start [-a/--app appname] [-p/--process processname]",
-		Desc:    "Starts an application, or one of the processes of the application.",
+		Usage:   "app-start [-a/--app appname] [-p/--process processname] [app filters]",
+		Desc:    "Starts an application, or one of the processes of the application." + appSelectorHelp,
 		MinArgs: 0,
 	}
 }
 
 func (c *AppStart) Run(context *cmd.Context, client *cmd.Client) error {
 	context.RawOutput()
-	appName, err := c.Guess()
-	if err != nil {
-		return err
-	}
-	u, err := cmd.GetURL(fmt.Sprintf("/apps/%s/start", appName))
-	if err != nil {
+	if err := c.selector.checkSingleApp(c.Flags()); err != nil {
 		return err
 	}
-	body := strings.NewReader("process=" + c.process)
-	request, err := http.NewRequest("POST", u, body)
-	if err != nil {
-		return err
+	if c.selector.active() {
+		return c.selector.run(context, client, "start", func(ctx *cmd.Context, appName string) error {
+			return appProcessAction(ctx, client, appName, "start", c.process)
+		})
 	}
-	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	response, err := client.Do(request)
+	appName, err := c.Guess()
 	if err != nil {
 		return err
 	}
-	return cmd.StreamJSONResponse(context.Stdout, response)
+	return appProcessAction(context, client, appName, "start", c.process)
 }
 
 func (c *AppStart) Flags() *gnuflag.FlagSet {
@@ -990,44 +1004,54 @@ func (c *AppStart) Flags() *gnuflag.FlagSet {
 		c.fs = c.GuessingCommand.Flags()
 		c.fs.StringVar(&c.process, "process", "", "Process name")
 		c.fs.StringVar(&c.process, "p", "", "Process name")
+		c.fs = c.selector.flags(c.fs)
 	}
 	return c.fs
 }
 
 type AppRestart struct {
 	cmd.GuessingCommand
-	process string
-	fs      *gnuflag.FlagSet
+	process  string
+	rolling  rollingOptions
+	selector appSelector
+	fs       *gnuflag.FlagSet
 }
 
 func (c *AppRestart) Run(context *cmd.Context, client *cmd.Client) error {
 	context.RawOutput()
-	appName, err := c.Guess()
-	if err != nil {
+	if err := c.selector.checkSingleApp(c.Flags()); err != nil {
 		return err
 	}
-	u, err := cmd.GetURL(fmt.Sprintf("/apps/%s/restart", appName))
-	if err != nil {
-		return err
+	restart := func(ctx *cmd.Context, appName string) error {
+		if c.rolling.enabled {
+			return rollingRestart(ctx, client, appName, c.process, c.rolling)
+		}
+		return appProcessAction(ctx, client, appName, "restart", c.process)
 	}
-	body := strings.NewReader("process=" + c.process)
-	request, err := http.NewRequest("POST", u, body)
-	if err != nil {
-		return err
+	if c.selector.active() {
+		return c.selector.run(context, client, "restart", restart)
 	}
-	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	response, err := client.Do(request)
+	appName, err := c.Guess()
 	if err != nil {
 		return err
 	}
-	return cmd.StreamJSONResponse(context.Stdout, response)
+	return restart(context, appName)
 }
 
 func (c *AppRestart) Info() *cmd.Info {
 	return &cmd.Info{
-		Name:    "app-restart",
-		Usage:   "app-restart [-a/--app appname] [-p/--process processname]",
-		Desc:    `Restarts an application, or one of the processes of the application.`,
+		Name:  "app-restart",
+		Usage: "app-restart [-a/--app appname] [-p/--process processname] [--rolling [--batch size] [--pause duration] [--timeout duration]] [app filters]",
+		Desc: `Restarts an application, or one of the processes of the application.
+
+The [[--rolling]] flag replaces the units in batches of [[--batch]] units
+instead of restarting the whole process at once. For each batch, new units are
+added and, once they are started, the same number of old units is removed, so
+the pool needs room for [[--batch]] extra units while the process keeps all
+its started units. The command waits [[--pause]] between batches and aborts if
+the units of a batch are not started after [[--timeout]], displaying the state
+of the units. It fails when the application has no units of the given
+process.` + appSelectorHelp,
 		MinArgs: 0,
 	}
 }
@@ -1037,10 +1061,35 @@ func (c *AppRestart) Flags() *gnuflag.FlagSet {
 		c.fs = c.GuessingCommand.Flags()
 		c.fs.StringVar(&c.process, "process", "", "Process name")
 		c.fs.StringVar(&c.process, "p", "", "Process name")
+		c.fs.BoolVar(&c.rolling.enabled, "rolling", false, "Restart the units in batches, waiting for the new units to start")
+		c.fs.IntVar(&c.rolling.batch, "batch", 1, "Number of units replaced at once in a rolling restart")
+		c.fs.DurationVar(&c.rolling.pause, "pause", 0, "Time to wait between batches in a rolling restart")
+		c.fs.DurationVar(&c.rolling.timeout, "timeout", 10*time.Minute, "Maximum time to wait for the units of a batch to start")
+		c.fs = c.selector.flags(c.fs)
 	}
 	return c.fs
 }
 
+// appProcessAction calls one of the start, stop and restart endpoints of an
+// app, streaming the result to the context.
+func appProcessAction(context *cmd.Context, client *cmd.Client, appName, action, process string) error {
+	u, err := cmd.GetURL(fmt.Sprintf("/apps/%s/%s", appName, action))
+	if err != nil {
+		return err
+	}
+	body := strings.NewReader("process=" + process)
+	request, err := http.NewRequest("POST", u, body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	return cmd.StreamJSONResponse(context.Stdout, response)
+}
+
 type CnameAdd struct {
 	cmd.GuessingCommand
 }
@@ -1137,6 +1186,21 @@ func addCName(cnames []string, g cmd.GuessingCommand, client *cmd.Client) error
 	return err
 }
 
+const unitProcessUsage = "Process name, defaults to the process of the project file (" + cmd.ProjectFileName + ")"
+
+// projectProcess returns the given process or, when it's empty, the process
+// of the project file of the working directory.
+func projectProcess(process string) (string, error) {
+	if process != "" {
+		return process, nil
+	}
+	project, err := cmd.CurrentProject()
+	if err != nil || project == nil {
+		return "", err
+	}
+	return project.Process, nil
+}
+
 type UnitAdd struct {
 	cmd.GuessingCommand
 	fs      *gnuflag.FlagSet
@@ -1156,8 +1220,8 @@ app to be able to add new units to it.`,
 func (c *UnitAdd) Flags() *gnuflag.FlagSet {
 	if c.fs == nil {
 		c.fs = c.GuessingCommand.Flags()
-		c.fs.StringVar(&c.process, "process", "", "Process name")
-		c.fs.StringVar(&c.process, "p", "", "Process name")
+		c.fs.StringVar(&c.process, "process", "", unitProcessUsage)
+		c.fs.StringVar(&c.process, "p", "", unitProcessUsage)
 	}
 	return c.fs
 }
@@ -1172,9 +1236,13 @@ func (c *UnitAdd) Run(context *cmd.Context, client *cmd.Client) error {
 	if err != nil {
 		return err
 	}
+	process, err := projectProcess(c.process)
+	if err != nil {
+		return err
+	}
 	val := url.Values{}
 	val.Add("units", context.Args[0])
-	val.Add("process", c.process)
+	val.Add("process", process)
 	request, err := http.NewRequest("PUT", u, bytes.NewBufferString(val.Encode()))
 	if err != nil {
 		return err
@@ -1207,8 +1275,8 @@ app to be able to remove units from it.`,
 func (c *UnitRemove) Flags() *gnuflag.FlagSet {
 	if c.fs == nil {
 		c.fs = c.GuessingCommand.Flags()
-		c.fs.StringVar(&c.process, "process", "", "Process name")
-		c.fs.StringVar(&c.process, "p", "", "Process name")
+		c.fs.StringVar(&c.process, "process", "", unitProcessUsage)
+		c.fs.StringVar(&c.process, "p", "", unitProcessUsage)
 	}
 	return c.fs
 }
@@ -1219,9 +1287,13 @@ func (c *UnitRemove) Run(context *cmd.Context, client *cmd.Client) error {
 	if err != nil {
 		return err
 	}
+	process, err := projectProcess(c.process)
+	if err != nil {
+		return err
+	}
 	val := url.Values{}
 	val.Add("units", context.Args[0])
-	val.Add("process", c.process)
+	val.Add("process", process)
 	url, err := cmd.GetURL(fmt.Sprintf("/apps/%s/units?%s", appName, val.Encode()))
 	if err != nil {
 		return err
@@ -1236,3 +1308,289 @@ func (c *UnitRemove) Run(context *cmd.Context, client *cmd.Client) error {
 	}
 	return cmd.StreamJSONResponse(context.Stdout, response)
 }
+
+// unitsPollInterval is the interval between requests to the API when waiting
+// for units to reach a given state.
+var unitsPollInterval = 5 * time.Second
+
+type UnitSet struct {
+	cmd.GuessingCommand
+	fs       *gnuflag.FlagSet
+	process  string
+	wait     bool
+	timeout  time.Duration
+	selector appSelector
+}
+
+func (c *UnitSet) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "unit-set",
+		Usage: "unit-set <# of units>|<process=# of units>... [-a/--app appname] [-p/--process processname] [-w/--wait] [--timeout duration] [app filters]",
+		Desc: `Sets the exact number of units of one or more processes of an application.
+The current number of units is read from the app and the difference is added
+or removed.
+
+The number of units may be given for a single process, chosen with
+[[--process]], or as a list of process=units pairs, for example:
+
+    $ tsuru unit-set -a myapp web=4 worker=2
+
+The [[--wait]] flag makes the command block until all units of the changed
+processes are started, or until the given [[--timeout]] expires. The final
+state of the units is displayed in the end.` + appSelectorHelp,
+		MinArgs: 1,
+	}
+}
+
+func (c *UnitSet) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = c.GuessingCommand.Flags()
+		c.fs.StringVar(&c.process, "process", "", unitProcessUsage)
+		c.fs.StringVar(&c.process, "p", "", unitProcessUsage)
+		wait := "Wait until the units of the processes are started"
+		c.fs.BoolVar(&c.wait, "wait", false, wait)
+		c.fs.BoolVar(&c.wait, "w", false, wait)
+		c.fs.DurationVar(&c.timeout, "timeout", 10*time.Minute, "Maximum time to wait for the units to start")
+		c.fs = c.selector.flags(c.fs)
+	}
+	return c.fs
+}
+
+type processUnitCount struct {
+	process string
+	units   int
+}
+
+func parseUnitCounts(args []string, process string) ([]processUnitCount, error) {
+	var result []processUnitCount
+	seen := make(map[string]bool)
+	for _, arg := range args {
+		name := process
+		value := arg
+		if parts := strings.SplitN(arg, "=", 2); len(parts) == 2 {
+			if process != "" {
+				return nil, errors.New("You can't use the --process flag with process=units pairs.")
+			}
+			name, value = parts[0], parts[1]
+		} else if len(args) > 1 {
+			return nil, errors.New("You must specify the units in the form process=units when setting multiple processes.")
+		}
+		units, err := strconv.Atoi(value)
+		if err != nil || units < 0 {
+			return nil, fmt.Errorf("Invalid number of units %q.", value)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("The number of units of process %q was given more than once.", name)
+		}
+		seen[name] = true
+		result = append(result, processUnitCount{process: name, units: units})
+	}
+	return result, nil
+}
+
+func (c *UnitSet) Run(context *cmd.Context, client *cmd.Client) error {
+	context.RawOutput()
+	if err := c.selector.checkSingleApp(c.Flags()); err != nil {
+		return err
+	}
+	var appName string
+	if !c.selector.active() {
+		var err error
+		appName, err = c.Guess()
+		if err != nil {
+			return err
+		}
+	}
+	process := c.process
+	if len(context.Args) == 1 && !strings.Contains(context.Args[0], "=") {
+		var err error
+		if process, err = projectProcess(process); err != nil {
+			return err
+		}
+	}
+	counts, err := parseUnitCounts(context.Args, process)
+	if err != nil {
+		return err
+	}
+	if c.selector.active() {
+		return c.selector.run(context, client, "set the units of", func(ctx *cmd.Context, appName string) error {
+			return c.setUnits(ctx, client, appName, counts)
+		})
+	}
+	return c.setUnits(context, client, appName, counts)
+}
+
+func (c *UnitSet) setUnits(context *cmd.Context, client *cmd.Client, appName string, wanted []processUnitCount) error {
+	a, err := loadApp(client, appName)
+	if err != nil {
+		return err
+	}
+	current := a.processUnits()
+	counts := make([]processUnitCount, len(wanted))
+	copy(counts, wanted)
+	for i, count := range counts {
+		if count.process != "" {
+			continue
+		}
+		if len(current) > 1 {
+			return errors.New("The app has more than one process, please use the --process flag or the process=units form.")
+		}
+		for process := range current {
+			counts[i].process = process
+		}
+	}
+	for _, count := range counts {
+		delta := count.units - len(current[count.process])
+		switch {
+		case delta > 0:
+			fmt.Fprintf(context.Stdout, "Adding %d unit(s) to process %q...\n", delta, count.process)
+			err = addUnits(context, client, appName, count.process, delta)
+		case delta < 0:
+			fmt.Fprintf(context.Stdout, "Removing %d unit(s) from process %q...\n", -delta, count.process)
+			err = removeUnits(context, client, appName, count.process, -delta)
+		default:
+			fmt.Fprintf(context.Stdout, "Process %q already has %d unit(s).\n", count.process, count.units)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if !c.wait {
+		return nil
+	}
+	a, err = waitForUnits(context, client, appName, c.timeout, func(a *app) bool {
+		for _, count := range counts {
+			process := count.process
+			if process == "" {
+				// The app had no units, so they were added to its default
+				// process, the only one it has now.
+				process = singleProcess(a)
+			}
+			if !processReady(process, count.units)(a) {
+				return false
+			}
+		}
+		return true
+	})
+	if a != nil {
+		renderUnitCounts(context.Stdout, a)
+	}
+	return err
+}
+
+// singleProcess returns the name of the process of the app when all its
+// units belong to the same process, or an empty string otherwise.
+func singleProcess(a *app) string {
+	units := a.processUnits()
+	if len(units) != 1 {
+		return ""
+	}
+	for process := range units {
+		return process
+	}
+	return ""
+}
+
+func addUnits(context *cmd.Context, client *cmd.Client, appName, process string, units int) error {
+	u, err := cmd.GetURL(fmt.Sprintf("/apps/%s/units", appName))
+	if err != nil {
+		return err
+	}
+	val := url.Values{}
+	val.Add("units", strconv.Itoa(units))
+	val.Add("process", process)
+	request, err := http.NewRequest("PUT", u, bytes.NewBufferString(val.Encode()))
+	if err != nil {
+		return err
+	}
+	request.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	return cmd.StreamJSONResponse(context.Stdout, response)
+}
+
+func removeUnits(context *cmd.Context, client *cmd.Client, appName, process string, units int) error {
+	val := url.Values{}
+	val.Add("units", strconv.Itoa(units))
+	val.Add("process", process)
+	u, err := cmd.GetURL(fmt.Sprintf("/apps/%s/units?%s", appName, val.Encode()))
+	if err != nil {
+		return err
+	}
+	request, err := http.NewRequest(http.MethodDelete, u, nil)
+	if err != nil {
+		return err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	return cmd.StreamJSONResponse(context.Stdout, response)
+}
+
+// waitForUnits polls the app until ready returns true or the timeout
+// expires. The last fetched state of the app is always returned, so callers
+// are able to report it.
+func waitForUnits(context *cmd.Context, client *cmd.Client, appName string, timeout time.Duration, ready func(*app) bool) (*app, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		a, err := loadApp(client, appName)
+		if err != nil {
+			return nil, err
+		}
+		if ready(a) {
+			return a, nil
+		}
+		if time.Now().Add(unitsPollInterval).After(deadline) {
+			return a, fmt.Errorf("timeout after %s waiting for units of app %q", timeout, appName)
+		}
+		if err = sleep(context, unitsPollInterval); err != nil {
+			return a, err
+		}
+	}
+}
+
+// sleep waits for the given duration, returning the error of the context of
+// the command when it's canceled first.
+func sleep(context *cmd.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-context.Context().Done():
+		return context.Context().Err()
+	}
+}
+
+func renderUnitCounts(w io.Writer, a *app) {
+	units := a.processUnits()
+	processes := make([]string, 0, len(units))
+	for process := range units {
+		processes = append(processes, process)
+	}
+	sort.Strings(processes)
+	table := cmd.NewTable()
+	table.Headers = cmd.Row([]string{"Process", "Units", "Status"})
+	for _, process := range processes {
+		table.AddRow(cmd.Row([]string{process, strconv.Itoa(len(units[process])), unitStatusText(units[process])}))
+	}
+	w.Write(table.Bytes())
+}
+
+// unitStatusText counts the units by status, e.g. "2 started, 1 error".
+func unitStatusText(units []unit) string {
+	statuses := make(map[string]int)
+	for _, u := range units {
+		statuses[u.Status]++
+	}
+	us := newUnitSorter(statuses)
+	sort.Sort(us)
+	statusText := make([]string, len(us.Statuses))
+	for i, status := range us.Statuses {
+		statusText[i] = fmt.Sprintf("%d %s", statuses[status], status)
+	}
+	return strings.Join(statusText, ", ")
+}
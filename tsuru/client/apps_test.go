@@ -7,11 +7,13 @@ package client
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
 	"strings"
+	"testing"
 	"time"
 
 	"github.com/tsuru/gnuflag"
@@ -778,6 +780,23 @@ func (s *S) TestAppRemoveWithoutConfirmation(c *check.C) {
 	c.Assert(stdout.String(), check.Equals, expected)
 }
 
+func (s *S) TestAppRemoveNonInteractive(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout:         &stdout,
+		Stderr:         &stderr,
+		Stdin:          strings.NewReader("y\n"),
+		NonInteractive: true,
+	}
+	command := AppRemove{}
+	command.Flags().Parse(true, []string{"--app", "ble"})
+	err := command.Run(&context, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "")
+	err = context.CheckInteractive("Are you sure?", "-y")
+	c.Assert(err, check.ErrorMatches, `unable to ask "Are you sure\?" in non-interactive mode, use -y to answer it`)
+}
+
 func (s *S) TestAppRemoveInfo(c *check.C) {
 	c.Assert((&AppRemove{}).Info(), check.NotNil)
 }
@@ -1680,6 +1699,26 @@ func (s *S) TestAppGrantInfo(c *check.C) {
 	c.Assert((&AppGrant{}).Info(), check.NotNil)
 }
 
+func (s *S) TestAppGrantRetriesConnectionErrors(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"cobrateam"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &flakyTransport{
+		failures:  1,
+		err:       errors.New("connection reset by peer"),
+		transport: &cmdtest.Transport{Message: "", Status: http.StatusOK},
+	}
+	command := AppGrant{}
+	command.Flags().Parse(true, []string{"--app", "games"})
+	err := command.Run(&context, retryingClient(trans, &context))
+	c.Assert(err, check.IsNil)
+	c.Assert(trans.calls, check.Equals, 2)
+	c.Assert(stdout.String(), check.Equals, `Team "cobrateam" was added to the "games" app`+"\n")
+}
+
 func (s *S) TestAppRevoke(c *check.C) {
 	var stdout, stderr bytes.Buffer
 	expected := `Team "cobrateam" was removed from the "games" app` + "\n"
@@ -1738,6 +1777,130 @@ func (s *S) TestAppList(c *check.C) {
 	c.Assert(stdout.String(), check.Equals, expected)
 }
 
+// flakyTransport fails the first requests, with the given status or error,
+// before handing them to the wrapped transport.
+type flakyTransport struct {
+	failures  int
+	status    int
+	header    http.Header
+	err       error
+	calls     int
+	transport http.RoundTripper
+}
+
+func (t *flakyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.calls++
+	if t.calls > t.failures {
+		return t.transport.RoundTrip(req)
+	}
+	if t.err != nil {
+		return nil, t.err
+	}
+	return &http.Response{
+		StatusCode: t.status,
+		Status:     fmt.Sprintf("%d %s", t.status, http.StatusText(t.status)),
+		Header:     t.header,
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}, nil
+}
+
+func retryingClient(trans http.RoundTripper, context *cmd.Context) *cmd.Client {
+	client := cmd.NewClient(&http.Client{Transport: trans}, context, manager)
+	client.MaxRetries = 3
+	client.RetryDelay = time.Millisecond
+	return client
+}
+
+func (s *S) TestAppListRetriesTransientErrors(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	result := `[{"ip":"10.10.10.10","name":"app1","units":[{"ID":"app1/0","Status":"started"}]}]`
+	context := cmd.Context{
+		Args:   []string{},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &flakyTransport{
+		failures:  2,
+		status:    http.StatusBadGateway,
+		transport: &cmdtest.Transport{Message: result, Status: http.StatusOK},
+	}
+	command := AppList{}
+	err := command.Run(&context, retryingClient(trans, &context))
+	c.Assert(err, check.IsNil)
+	c.Assert(trans.calls, check.Equals, 3)
+	c.Assert(stdout.String(), check.Matches, `(?s).*\| app1 +\| 1 started \| 10.10.10.10 \|.*`)
+}
+
+func (s *S) TestAppListRetriesVerbose(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &flakyTransport{
+		failures:  1,
+		status:    http.StatusServiceUnavailable,
+		header:    http.Header{"Retry-After": []string{"0"}},
+		transport: &cmdtest.Transport{Message: "[]", Status: http.StatusOK},
+	}
+	client := retryingClient(trans, &context)
+	client.Verbosity = 1
+	command := AppList{}
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(trans.calls, check.Equals, 2)
+	c.Assert(stdout.String(), check.Matches, `(?s).*Request uri="/1.0/apps\?" failed \(503 Service Unavailable\), retrying in 0s \(retry 1 of 3\).*`)
+	c.Assert(strings.Count(stdout.String(), "<Request uri="), check.Equals, 2)
+}
+
+func (s *S) TestAppListGivesUpAfterMaxRetries(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &flakyTransport{failures: 10, status: http.StatusGatewayTimeout}
+	command := AppList{}
+	err := command.Run(&context, retryingClient(trans, &context))
+	c.Assert(err, check.ErrorMatches, "504 Gateway Timeout")
+	c.Assert(trans.calls, check.Equals, 4)
+}
+
+func (s *S) TestAppListDoesNotRetryLongRetryAfter(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &flakyTransport{
+		failures: 10,
+		status:   http.StatusServiceUnavailable,
+		header:   http.Header{"Retry-After": []string{"3600"}},
+	}
+	command := AppList{}
+	err := command.Run(&context, retryingClient(trans, &context))
+	c.Assert(err, check.ErrorMatches, "503 Service Unavailable")
+	c.Assert(trans.calls, check.Equals, 1)
+}
+
+func (s *S) TestAppListDoesNotRetryClientErrors(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &flakyTransport{failures: 10, status: http.StatusInternalServerError}
+	command := AppList{}
+	err := command.Run(&context, retryingClient(trans, &context))
+	c.Assert(err, check.NotNil)
+	c.Assert(trans.calls, check.Equals, 1)
+}
+
 func (s *S) TestAppListDisplayAppsInAlphabeticalOrder(c *check.C) {
 	var stdout, stderr bytes.Buffer
 	result := `[{"ip":"10.10.10.11","name":"sapp","units":[{"ID":"sapp1/0","Status":"started"}]},{"ip":"10.10.10.10","name":"app1","units":[{"ID":"app1/0","Status":"started"}]}]`
@@ -1810,7 +1973,7 @@ func (s *S) TestAppListErrorFetchingUnitsVerbose(c *check.C) {
 		"GET /1.0/apps? HTTP/1.1\r\n" +
 		"Host: localhost:8080\r\n" +
 		"Connection: close\r\n" +
-		"Authorization: bearer sometoken\r\n" +
+		"Authorization: bearer REDACTED\r\n" +
 		"\r\n" +
 		"*************************** </Request uri=\"/1.0/apps?\"> **********************************\n" +
 		"+-------------+-------------------------------+-------------+\n" +
@@ -2286,6 +2449,24 @@ func (s *S) TestAppStart(c *check.C) {
 	c.Assert(stdout.String(), check.Equals, expectedOut)
 }
 
+func (s *S) TestAppStartIsNotRetried(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &flakyTransport{
+		failures:  1,
+		status:    http.StatusBadGateway,
+		transport: &cmdtest.Transport{Message: "", Status: http.StatusOK},
+	}
+	command := AppStart{}
+	command.Flags().Parse(true, []string{"--app", "handful_of_nothing"})
+	err := command.Run(&context, retryingClient(trans, &context))
+	c.Assert(err, check.ErrorMatches, "502 Bad Gateway")
+	c.Assert(trans.calls, check.Equals, 1)
+}
+
 func (s *S) TestAppStartWithoutTheFlag(c *check.C) {
 	var (
 		called         bool
@@ -2452,6 +2633,35 @@ func (s *S) TestUnitAdd(c *check.C) {
 	c.Assert(stdout.String(), check.Equals, expectedOut)
 }
 
+func (s *S) TestUnitAddProjectProcess(c *check.C) {
+	_, restore := projectDir(c, "app: radio\nprocess: worker\n")
+	defer restore()
+	var stdout, stderr bytes.Buffer
+	var processes []string
+	context := cmd.Context{
+		Args:   []string{"3"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: `{"Message":"-- added unit --"}`, Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			processes = append(processes, req.FormValue("process"))
+			return strings.HasSuffix(req.URL.Path, "/apps/radio/units") && req.Method == "PUT"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := UnitAdd{}
+	command.Flags().Parse(true, []string{})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	command = UnitAdd{}
+	command.Flags().Parse(true, []string{"-p", "web"})
+	err = command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(processes, check.DeepEquals, []string{"worker", "web"})
+}
+
 func (s *S) TestUnitAddFailure(c *check.C) {
 	var stdout, stderr bytes.Buffer
 	context := cmd.Context{
@@ -2532,3 +2742,256 @@ func (s *S) TestUnitRemoveInfo(c *check.C) {
 func (s *S) TestUnitRemoveIsACommand(c *check.C) {
 	var _ cmd.Command = &UnitRemove{}
 }
+
+func (s *S) TestUnitSetInfo(c *check.C) {
+	c.Assert((&UnitSet{}).Info(), check.NotNil)
+}
+
+func (s *S) TestUnitSetIsFlaggedACommand(c *check.C) {
+	var _ cmd.FlaggedCommand = &UnitSet{}
+}
+
+func (s *S) TestParseUnitCounts(c *check.C) {
+	counts, err := parseUnitCounts([]string{"3"}, "web")
+	c.Assert(err, check.IsNil)
+	c.Assert(counts, check.DeepEquals, []processUnitCount{{process: "web", units: 3}})
+	counts, err = parseUnitCounts([]string{"web=4", "worker=0"}, "")
+	c.Assert(err, check.IsNil)
+	c.Assert(counts, check.DeepEquals, []processUnitCount{{process: "web", units: 4}, {process: "worker", units: 0}})
+	_, err = parseUnitCounts([]string{"web=4"}, "web")
+	c.Assert(err, check.ErrorMatches, "You can't use the --process flag with process=units pairs.")
+	_, err = parseUnitCounts([]string{"4", "2"}, "")
+	c.Assert(err, check.ErrorMatches, "You must specify the units in the form process=units .*")
+	_, err = parseUnitCounts([]string{"web=-1"}, "")
+	c.Assert(err, check.ErrorMatches, `Invalid number of units "-1".`)
+	_, err = parseUnitCounts([]string{"web=2", "worker=1", "web=3"}, "")
+	c.Assert(err, check.ErrorMatches, `The number of units of process "web" was given more than once.`)
+}
+
+func (s *S) TestUnitSet(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"web=4", "worker=1", "clock=1"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	appResult := `{"name":"radio","units":[
+{"ID":"w1","Status":"started","ProcessName":"web"},
+{"ID":"w2","Status":"started","ProcessName":"web"},
+{"ID":"k1","Status":"started","ProcessName":"worker"},
+{"ID":"k2","Status":"started","ProcessName":"worker"},
+{"ID":"k3","Status":"started","ProcessName":"worker"},
+{"ID":"c1","Status":"started","ProcessName":"clock"}]}`
+	added, _ := json.Marshal(io.SimpleJsonMessage{Message: "added\n"})
+	removed, _ := json.Marshal(io.SimpleJsonMessage{Message: "removed\n"})
+	trans := &cmdtest.MultiConditionalTransport{
+		ConditionalTransports: []cmdtest.ConditionalTransport{
+			{
+				Transport: cmdtest.Transport{Message: appResult, Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					return strings.HasSuffix(req.URL.Path, "/apps/radio") && req.Method == "GET"
+				},
+			},
+			{
+				Transport: cmdtest.Transport{Message: string(added), Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					c.Assert(req.FormValue("process"), check.Equals, "web")
+					c.Assert(req.FormValue("units"), check.Equals, "2")
+					return strings.HasSuffix(req.URL.Path, "/apps/radio/units") && req.Method == "PUT"
+				},
+			},
+			{
+				Transport: cmdtest.Transport{Message: string(removed), Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					c.Assert(req.FormValue("process"), check.Equals, "worker")
+					c.Assert(req.FormValue("units"), check.Equals, "2")
+					return strings.HasSuffix(req.URL.Path, "/apps/radio/units") && req.Method == http.MethodDelete
+				},
+			},
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := UnitSet{}
+	command.Flags().Parse(true, []string{"-a", "radio"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	expected := `Adding 2 unit(s) to process "web"...
+added
+Removing 2 unit(s) from process "worker"...
+removed
+Process "clock" already has 1 unit(s).
+`
+	c.Assert(stdout.String(), check.Equals, expected)
+}
+
+func (s *S) TestUnitSetSingleProcessApp(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"3"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	appResult := `{"name":"radio","units":[{"ID":"w1","Status":"started","ProcessName":"web"}]}`
+	added, _ := json.Marshal(io.SimpleJsonMessage{Message: "added\n"})
+	trans := &cmdtest.MultiConditionalTransport{
+		ConditionalTransports: []cmdtest.ConditionalTransport{
+			{
+				Transport: cmdtest.Transport{Message: appResult, Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					return strings.HasSuffix(req.URL.Path, "/apps/radio") && req.Method == "GET"
+				},
+			},
+			{
+				Transport: cmdtest.Transport{Message: string(added), Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					c.Assert(req.FormValue("process"), check.Equals, "web")
+					c.Assert(req.FormValue("units"), check.Equals, "2")
+					return strings.HasSuffix(req.URL.Path, "/apps/radio/units") && req.Method == "PUT"
+				},
+			},
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := UnitSet{}
+	command.Flags().Parse(true, []string{"-a", "radio"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestUnitSetMultipleProcessesWithoutProcess(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"3"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	appResult := `{"name":"radio","units":[{"ID":"w1","ProcessName":"web"},{"ID":"k1","ProcessName":"worker"}]}`
+	client := cmd.NewClient(&http.Client{Transport: &cmdtest.Transport{Message: appResult, Status: http.StatusOK}}, nil, manager)
+	command := UnitSet{}
+	command.Flags().Parse(true, []string{"-a", "radio"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.ErrorMatches, "The app has more than one process, .*")
+}
+
+func (s *S) TestUnitSetWait(c *check.C) {
+	defer func(d time.Duration) { unitsPollInterval = d }(unitsPollInterval)
+	unitsPollInterval = time.Millisecond
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"2"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	before := `{"name":"radio","units":[{"ID":"w1","Status":"started","ProcessName":"web"}]}`
+	starting := `{"name":"radio","units":[{"ID":"w1","Status":"started","ProcessName":"web"},{"ID":"w2","Status":"starting","ProcessName":"web"}]}`
+	started := `{"name":"radio","units":[{"ID":"w1","Status":"started","ProcessName":"web"},{"ID":"w2","Status":"started","ProcessName":"web"}]}`
+	added, _ := json.Marshal(io.SimpleJsonMessage{Message: "added\n"})
+	isGet := func(req *http.Request) bool {
+		return strings.HasSuffix(req.URL.Path, "/apps/radio") && req.Method == "GET"
+	}
+	trans := &cmdtest.MultiConditionalTransport{
+		ConditionalTransports: []cmdtest.ConditionalTransport{
+			{Transport: cmdtest.Transport{Message: before, Status: http.StatusOK}, CondFunc: isGet},
+			{
+				Transport: cmdtest.Transport{Message: string(added), Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					return strings.HasSuffix(req.URL.Path, "/apps/radio/units") && req.Method == "PUT"
+				},
+			},
+			{Transport: cmdtest.Transport{Message: starting, Status: http.StatusOK}, CondFunc: isGet},
+			{Transport: cmdtest.Transport{Message: started, Status: http.StatusOK}, CondFunc: isGet},
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := UnitSet{}
+	command.Flags().Parse(true, []string{"-a", "radio", "-p", "web", "--wait"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	expected := `Adding 1 unit(s) to process "web"...
+added
++---------+-------+-----------+
+| Process | Units | Status    |
++---------+-------+-----------+
+| web     | 2     | 2 started |
++---------+-------+-----------+
+`
+	c.Assert(stdout.String(), check.Equals, expected)
+}
+
+func (s *S) TestUnitSetWaitAppWithoutUnits(c *check.C) {
+	defer func(d time.Duration) { unitsPollInterval = d }(unitsPollInterval)
+	unitsPollInterval = time.Millisecond
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"2"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	before := `{"name":"radio","units":[]}`
+	started := `{"name":"radio","units":[{"ID":"w1","Status":"started","ProcessName":"web"},{"ID":"w2","Status":"started","ProcessName":"web"}]}`
+	added, _ := json.Marshal(io.SimpleJsonMessage{Message: "added\n"})
+	isGet := func(req *http.Request) bool {
+		return strings.HasSuffix(req.URL.Path, "/apps/radio") && req.Method == "GET"
+	}
+	trans := &cmdtest.MultiConditionalTransport{
+		ConditionalTransports: []cmdtest.ConditionalTransport{
+			{Transport: cmdtest.Transport{Message: before, Status: http.StatusOK}, CondFunc: isGet},
+			{
+				Transport: cmdtest.Transport{Message: string(added), Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					c.Assert(req.FormValue("process"), check.Equals, "")
+					c.Assert(req.FormValue("units"), check.Equals, "2")
+					return strings.HasSuffix(req.URL.Path, "/apps/radio/units") && req.Method == "PUT"
+				},
+			},
+			{Transport: cmdtest.Transport{Message: started, Status: http.StatusOK}, CondFunc: isGet},
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := UnitSet{}
+	command.Flags().Parse(true, []string{"-a", "radio", "--wait", "--timeout", "1s"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Matches, `(?s)Adding 2 unit\(s\) to process "".*\| web .*\| 2 started \|.*`)
+}
+
+func (s *S) TestUnitSetWaitTimeout(c *check.C) {
+	defer func(d time.Duration) { unitsPollInterval = d }(unitsPollInterval)
+	unitsPollInterval = time.Millisecond
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"1"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	appResult := `{"name":"radio","units":[{"ID":"w1","Status":"error","ProcessName":"web"}]}`
+	client := cmd.NewClient(&http.Client{Transport: &cmdtest.Transport{Message: appResult, Status: http.StatusOK}}, nil, manager)
+	command := UnitSet{}
+	command.Flags().Parse(true, []string{"-a", "radio", "-w", "--timeout", "10ms"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.ErrorMatches, `timeout after 10ms waiting for units of app "radio"`)
+	c.Assert(stdout.String(), check.Matches, `(?s)Process "web" already has 1 unit\(s\)\..*1 error.*`)
+}
+
+func benchmarkAppInfo(b *testing.B, keepAlive bool) {
+	server := newAPIServer()
+	defer server.Close()
+	client := server.client(keepAlive)
+	context := cmd.Context{Stdout: ioutil.Discard, Stderr: ioutil.Discard}
+	command := AppInfo{}
+	command.Flags().Parse(true, []string{"-a", "app1"})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := command.Run(&context, client); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAppInfoKeepAlive(b *testing.B) {
+	benchmarkAppInfo(b, true)
+}
+
+func BenchmarkAppInfoNoKeepAlive(b *testing.B) {
+	benchmarkAppInfo(b, false)
+}
@@ -35,6 +35,9 @@ func (c *UserCreate) Run(context *cmd.Context, client *cmd.Client) error {
 		return err
 	}
 	email := context.Args[0]
+	if err = context.CheckInteractive("Password", ""); err != nil {
+		return err
+	}
 	fmt.Fprint(context.Stdout, "Password: ")
 	password, err := cmd.PasswordFromReader(context.Stdin)
 	if err != nil {
@@ -107,6 +110,9 @@ func (c *UserRemove) Run(context *cmd.Context, client *cmd.Client) error {
 			return err
 		}
 	}
+	if err = context.CheckInteractive(fmt.Sprintf("Are you sure you want to remove the user %q from tsuru?", email), ""); err != nil {
+		return err
+	}
 	fmt.Fprintf(context.Stdout, `Are you sure you want to remove the user %q from tsuru? (y/n) `, email)
 	fmt.Fscanf(context.Stdin, "%s", &answer)
 	if answer != "y" {
@@ -278,6 +284,9 @@ func (c *ChangePassword) Run(context *cmd.Context, client *cmd.Client) error {
 	if err != nil {
 		return err
 	}
+	if err = context.CheckInteractive("Current password", ""); err != nil {
+		return err
+	}
 	fmt.Fprint(context.Stdout, "Current password: ")
 	old, err := cmd.PasswordFromReader(context.Stdin)
 	if err != nil {
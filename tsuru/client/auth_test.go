@@ -6,11 +6,20 @@ package client
 
 import (
 	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"gopkg.in/check.v1"
 
@@ -964,3 +973,835 @@ func (s *S) TestListUsersFlags(c *check.C) {
 	c.Check(srole.Value.String(), check.Equals, "role1")
 	c.Check(srole.DefValue, check.Equals, "")
 }
+
+// tokenHome points HOME to an empty directory with the given target list,
+// unsetting TSURU_TOKEN so the tokens are read from the files.
+func tokenHome(c *check.C, targets map[string]string) func() {
+	oldHome, oldToken, oldTarget := os.Getenv("HOME"), os.Getenv("TSURU_TOKEN"), os.Getenv("TSURU_TARGET")
+	home := c.MkDir()
+	os.Setenv("HOME", home)
+	os.Unsetenv("TSURU_TOKEN")
+	var list string
+	for label, target := range targets {
+		list += label + "\t" + target + "\n"
+	}
+	err := os.MkdirAll(filepath.Join(home, ".tsuru"), 0700)
+	c.Assert(err, check.IsNil)
+	err = ioutil.WriteFile(filepath.Join(home, ".tsuru", "targets"), []byte(list), 0600)
+	c.Assert(err, check.IsNil)
+	return func() {
+		os.Setenv("HOME", oldHome)
+		os.Setenv("TSURU_TOKEN", oldToken)
+		os.Setenv("TSURU_TARGET", oldTarget)
+	}
+}
+
+// loginServer is a tsuru API using native authentication, which issues
+// tokens named after the host used in the request.
+func loginServer() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/auth/scheme":
+			w.Write([]byte(`{"name":"native","data":{}}`))
+		case r.Method == "POST" && r.URL.Path == "/1.0/users/me@example.com/tokens":
+			w.Write([]byte(`{"token":"token-` + strings.Split(r.Host, ":")[0] + `"}`))
+		}
+	}))
+}
+
+// runBaseCommand runs one of the commands of the base manager against the
+// given target.
+func runBaseCommand(c *check.C, name, target string, args ...string) (string, error) {
+	os.Setenv("TSURU_TARGET", target)
+	baseManager := cmd.BuildBaseManager("glb", "1.0.0", "Supported-Tsuru", nil)
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   args,
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Stdin:  strings.NewReader("secret\n"),
+	}
+	err := baseManager.Commands[name].Run(&context, cmd.NewClient(&http.Client{}, &context, baseManager))
+	return stdout.String(), err
+}
+
+func readTokenOf(c *check.C, target string) string {
+	os.Setenv("TSURU_TARGET", target)
+	token, err := cmd.ReadToken()
+	c.Assert(err, check.IsNil)
+	return token
+}
+
+func (s *S) TestLoginAndLogoutArePerTarget(c *check.C) {
+	server := loginServer()
+	defer server.Close()
+	prod, staging := server.URL, strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	defer tokenHome(c, map[string]string{"prod": prod, "staging": staging})()
+	out, err := runBaseCommand(c, "login", prod, "me@example.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Matches, "(?s).*Successfully logged in!\n")
+	c.Assert(readTokenOf(c, prod), check.Equals, "token-127.0.0.1")
+	c.Assert(readTokenOf(c, staging), check.Equals, "")
+	_, err = runBaseCommand(c, "login", staging, "me@example.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(readTokenOf(c, staging), check.Equals, "token-localhost")
+	c.Assert(readTokenOf(c, prod), check.Equals, "token-127.0.0.1")
+	out, err = runBaseCommand(c, "logout", prod)
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Equals, "Successfully logged out!\n")
+	c.Assert(readTokenOf(c, prod), check.Equals, "")
+	c.Assert(readTokenOf(c, staging), check.Equals, "token-localhost")
+}
+
+func (s *S) TestReadTokenKeepsLegacyToken(c *check.C) {
+	defer tokenHome(c, map[string]string{"prod": "https://prod.example.com", "staging": "https://staging.example.com"})()
+	legacyPath := cmd.JoinWithUserDir(".tsuru", "token")
+	err := ioutil.WriteFile(legacyPath, []byte("old-token"), 0600)
+	c.Assert(err, check.IsNil)
+	c.Assert(readTokenOf(c, "https://prod.example.com/"), check.Equals, "old-token")
+	c.Assert(readTokenOf(c, "https://staging.example.com"), check.Equals, "old-token")
+	data, err := ioutil.ReadFile(legacyPath)
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals, "old-token")
+	_, err = os.Stat(cmd.JoinWithUserDir(".tsuru", "token.d", "prod"))
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+}
+
+func (s *S) TestLoginReplacesLegacyToken(c *check.C) {
+	server := loginServer()
+	defer server.Close()
+	prod, staging := server.URL, strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	defer tokenHome(c, map[string]string{"prod": prod, "staging": staging})()
+	legacyPath := cmd.JoinWithUserDir(".tsuru", "token")
+	err := ioutil.WriteFile(legacyPath, []byte("old-token"), 0600)
+	c.Assert(err, check.IsNil)
+	_, err = runBaseCommand(c, "login", prod, "me@example.com")
+	c.Assert(err, check.IsNil)
+	_, err = os.Stat(legacyPath)
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+	c.Assert(readTokenOf(c, prod), check.Equals, "token-127.0.0.1")
+	c.Assert(readTokenOf(c, staging), check.Equals, "")
+}
+
+func (s *S) TestLogoutRemovesLegacyToken(c *check.C) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	defer tokenHome(c, map[string]string{"prod": server.URL})()
+	legacyPath := cmd.JoinWithUserDir(".tsuru", "token")
+	err := ioutil.WriteFile(legacyPath, []byte("old-token"), 0600)
+	c.Assert(err, check.IsNil)
+	out, err := runBaseCommand(c, "logout", server.URL)
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Equals, "Successfully logged out!\n")
+	_, err = os.Stat(legacyPath)
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+	_, err = runBaseCommand(c, "logout", server.URL)
+	c.Assert(err, check.ErrorMatches, "You're not logged in!")
+}
+
+func (s *S) TestReadTokenTargetWithoutLabel(c *check.C) {
+	defer tokenHome(c, map[string]string{"prod": "https://prod.example.com"})()
+	legacyPath := cmd.JoinWithUserDir(".tsuru", "token")
+	err := ioutil.WriteFile(legacyPath, []byte("old-token"), 0600)
+	c.Assert(err, check.IsNil)
+	os.Setenv("TSURU_TARGET", "https://other.example.com")
+	token, err := cmd.ReadToken()
+	c.Assert(err, check.IsNil)
+	c.Assert(token, check.Equals, "old-token")
+	_, err = os.Stat(legacyPath)
+	c.Assert(err, check.IsNil)
+}
+
+func (s *S) TestTargetRemoveRemovesToken(c *check.C) {
+	defer tokenHome(c, map[string]string{"prod": "https://prod.example.com", "staging": "https://staging.example.com"})()
+	tokenDir := cmd.JoinWithUserDir(".tsuru", "token.d")
+	err := os.MkdirAll(tokenDir, 0700)
+	c.Assert(err, check.IsNil)
+	for _, label := range []string{"prod", "staging"} {
+		err = ioutil.WriteFile(filepath.Join(tokenDir, label), []byte(label+"-token"), 0600)
+		c.Assert(err, check.IsNil)
+	}
+	baseManager := cmd.BuildBaseManager("glb", "1.0.0", "Supported-Tsuru", nil)
+	context := cmd.Context{Args: []string{"staging"}, Stdout: ioutil.Discard, Stderr: ioutil.Discard}
+	err = baseManager.Commands["target-remove"].Run(&context, nil)
+	c.Assert(err, check.IsNil)
+	_, err = os.Stat(filepath.Join(tokenDir, "staging"))
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+	os.Setenv("TSURU_TARGET", "https://prod.example.com")
+	token, err := cmd.ReadToken()
+	c.Assert(err, check.IsNil)
+	c.Assert(token, check.Equals, "prod-token")
+}
+
+func (s *S) TestTargetRemoveWithoutToken(c *check.C) {
+	defer tokenHome(c, map[string]string{"prod": "https://prod.example.com", "staging": "https://staging.example.com"})()
+	os.Setenv("TSURU_CREDENTIAL_STORE", "encrypted")
+	defer os.Unsetenv("TSURU_CREDENTIAL_STORE")
+	baseManager := cmd.BuildBaseManager("glb", "1.0.0", "Supported-Tsuru", nil)
+	context := cmd.Context{Args: []string{"staging"}, Stdout: ioutil.Discard, Stderr: ioutil.Discard}
+	err := baseManager.Commands["target-remove"].Run(&context, nil)
+	c.Assert(err, check.IsNil)
+	_, err = os.Stat(cmd.JoinWithUserDir(".tsuru", "credentials.enc"))
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+	data, err := ioutil.ReadFile(cmd.JoinWithUserDir(".tsuru", "targets"))
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Equals, "prod\thttps://prod.example.com\n")
+}
+
+func (s *S) TestTargetRemoveTokenError(c *check.C) {
+	defer tokenHome(c, map[string]string{"prod": "https://prod.example.com", "staging": "https://staging.example.com"})()
+	os.Setenv("TSURU_CREDENTIAL_STORE", "encrypted")
+	defer os.Unsetenv("TSURU_CREDENTIAL_STORE")
+	err := ioutil.WriteFile(cmd.JoinWithUserDir(".tsuru", "credentials.enc"), []byte(`{"Salt":"c2FsdA==","Iterations":1}`), 0600)
+	c.Assert(err, check.IsNil)
+	baseManager := cmd.BuildBaseManager("glb", "1.0.0", "Supported-Tsuru", nil)
+	context := cmd.Context{Args: []string{"staging"}, Stdout: ioutil.Discard, Stderr: ioutil.Discard}
+	err = baseManager.Commands["target-remove"].Run(&context, nil)
+	c.Assert(err, check.ErrorMatches, `unable to remove the token of target "staging": the credential store is encrypted, .*`)
+	data, err := ioutil.ReadFile(cmd.JoinWithUserDir(".tsuru", "targets"))
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Matches, "(?s).*staging\thttps://staging.example.com\n.*")
+}
+
+func (s *S) TestEncryptedCredentialStore(c *check.C) {
+	server := loginServer()
+	defer server.Close()
+	prod, staging := server.URL, strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	defer tokenHome(c, map[string]string{"prod": prod, "staging": staging})()
+	os.Setenv("TSURU_CREDENTIAL_STORE", "encrypted")
+	defer os.Unsetenv("TSURU_CREDENTIAL_STORE")
+	os.Setenv("TSURU_CREDENTIAL_PASSPHRASE", "my passphrase")
+	defer os.Unsetenv("TSURU_CREDENTIAL_PASSPHRASE")
+	_, err := runBaseCommand(c, "login", prod, "me@example.com")
+	c.Assert(err, check.IsNil)
+	_, err = runBaseCommand(c, "login", staging, "me@example.com")
+	c.Assert(err, check.IsNil)
+	data, err := ioutil.ReadFile(cmd.JoinWithUserDir(".tsuru", "credentials.enc"))
+	c.Assert(err, check.IsNil)
+	c.Assert(strings.Contains(string(data), "token-"), check.Equals, false)
+	_, err = os.Stat(cmd.JoinWithUserDir(".tsuru", "token.d"))
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+	c.Assert(readTokenOf(c, prod), check.Equals, "token-127.0.0.1")
+	c.Assert(readTokenOf(c, staging), check.Equals, "token-localhost")
+	_, err = runBaseCommand(c, "logout", staging)
+	c.Assert(err, check.IsNil)
+	c.Assert(readTokenOf(c, staging), check.Equals, "")
+	c.Assert(readTokenOf(c, prod), check.Equals, "token-127.0.0.1")
+	os.Setenv("TSURU_CREDENTIAL_PASSPHRASE", "wrong")
+	_, err = cmd.ReadToken()
+	c.Assert(err, check.ErrorMatches, "invalid passphrase for the encrypted credential store")
+}
+
+func (s *S) TestEncryptedCredentialStoreKeepsLegacyToken(c *check.C) {
+	defer tokenHome(c, map[string]string{"prod": "https://prod.example.com"})()
+	os.Setenv("TSURU_CREDENTIAL_STORE", "encrypted")
+	defer os.Unsetenv("TSURU_CREDENTIAL_STORE")
+	os.Setenv("TSURU_CREDENTIAL_PASSPHRASE", "my passphrase")
+	defer os.Unsetenv("TSURU_CREDENTIAL_PASSPHRASE")
+	legacyPath := cmd.JoinWithUserDir(".tsuru", "token")
+	err := ioutil.WriteFile(legacyPath, []byte("old-token"), 0600)
+	c.Assert(err, check.IsNil)
+	c.Assert(readTokenOf(c, "https://prod.example.com"), check.Equals, "old-token")
+	_, err = os.Stat(legacyPath)
+	c.Assert(err, check.IsNil)
+	_, err = os.Stat(cmd.JoinWithUserDir(".tsuru", "credentials.enc"))
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+}
+
+func (s *S) TestEncryptedCredentialStoreWithoutPassphrase(c *check.C) {
+	defer tokenHome(c, map[string]string{"prod": "https://prod.example.com"})()
+	os.Setenv("TSURU_CREDENTIAL_STORE", "encrypted")
+	defer os.Unsetenv("TSURU_CREDENTIAL_STORE")
+	err := ioutil.WriteFile(cmd.JoinWithUserDir(".tsuru", "credentials.enc"), []byte(`{"Salt":"c2FsdA==","Iterations":1}`), 0600)
+	c.Assert(err, check.IsNil)
+	os.Setenv("TSURU_TARGET", "https://prod.example.com")
+	_, err = cmd.ReadToken()
+	c.Assert(err, check.ErrorMatches, "the credential store is encrypted, please set TSURU_CREDENTIAL_PASSPHRASE or run the command in a terminal")
+}
+
+const credentialHelper = `#!/bin/sh
+input=$(cat)
+echo "$1 $input" >> "$HELPER_DIR/log"
+case "$1" in
+get) cat "$HELPER_DIR/token" 2>/dev/null || true;;
+store) echo "$input" > "$HELPER_DIR/token";;
+erase) rm "$HELPER_DIR/token";;
+esac
+`
+
+func (s *S) TestCredentialHelper(c *check.C) {
+	server := loginServer()
+	defer server.Close()
+	defer tokenHome(c, map[string]string{"prod": server.URL})()
+	dir := c.MkDir()
+	err := ioutil.WriteFile(filepath.Join(dir, "tsuru-credential-test"), []byte(credentialHelper), 0755)
+	c.Assert(err, check.IsNil)
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	os.Setenv("HELPER_DIR", dir)
+	defer os.Unsetenv("HELPER_DIR")
+	os.Setenv("TSURU_CREDENTIAL_STORE", "test")
+	defer os.Unsetenv("TSURU_CREDENTIAL_STORE")
+	_, err = runBaseCommand(c, "login", server.URL, "me@example.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(readTokenOf(c, server.URL), check.Equals, "token-127.0.0.1")
+	c.Assert(readTokenOf(c, server.URL), check.Equals, "token-127.0.0.1")
+	_, err = runBaseCommand(c, "logout", server.URL)
+	c.Assert(err, check.IsNil)
+	c.Assert(readTokenOf(c, server.URL), check.Equals, "")
+	log, err := ioutil.ReadFile(filepath.Join(dir, "log"))
+	c.Assert(err, check.IsNil)
+	expected := fmt.Sprintf(`get {"Target":"prod","URL":%[1]q}
+store {"Target":"prod","URL":%[1]q,"Token":"token-127.0.0.1"}
+erase {"Target":"prod","URL":%[1]q}
+get {"Target":"prod","URL":%[1]q}
+`, server.URL)
+	c.Assert(string(log), check.Equals, expected)
+}
+
+func (s *S) TestCredentialHelperFailure(c *check.C) {
+	defer tokenHome(c, map[string]string{"prod": "https://prod.example.com"})()
+	dir := c.MkDir()
+	helper := "#!/bin/sh\necho 'vault is sealed' >&2\nexit 1\n"
+	err := ioutil.WriteFile(filepath.Join(dir, "helper"), []byte(helper), 0755)
+	c.Assert(err, check.IsNil)
+	os.Setenv("TSURU_CREDENTIAL_STORE", filepath.Join(dir, "helper"))
+	defer os.Unsetenv("TSURU_CREDENTIAL_STORE")
+	os.Setenv("TSURU_TARGET", "https://prod.example.com")
+	_, err = cmd.ReadToken()
+	c.Assert(err, check.ErrorMatches, `credential helper ".*/helper" failed to get the token: vault is sealed`)
+}
+
+func (s *S) TestClientDoWithBrokenCredentialStore(c *check.C) {
+	var authorization []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = append(authorization, r.Header.Get("Authorization"))
+	}))
+	defer server.Close()
+	defer tokenHome(c, map[string]string{"prod": server.URL})()
+	dir := c.MkDir()
+	helper := "#!/bin/sh\necho 'vault is sealed' >&2\nexit 1\n"
+	err := ioutil.WriteFile(filepath.Join(dir, "helper"), []byte(helper), 0755)
+	c.Assert(err, check.IsNil)
+	os.Setenv("TSURU_CREDENTIAL_STORE", filepath.Join(dir, "helper"))
+	defer os.Unsetenv("TSURU_CREDENTIAL_STORE")
+	os.Setenv("TSURU_TARGET", server.URL)
+	var stderr bytes.Buffer
+	client := cmd.NewClient(&http.Client{}, &cmd.Context{Stdout: ioutil.Discard, Stderr: &stderr}, manager)
+	for i := 0; i < 2; i++ {
+		request, err := http.NewRequest("GET", server.URL+"/1.0/info", nil)
+		c.Assert(err, check.IsNil)
+		response, err := client.Do(request)
+		c.Assert(err, check.IsNil)
+		response.Body.Close()
+	}
+	c.Assert(authorization, check.DeepEquals, []string{"", ""})
+	c.Assert(stderr.String(), check.Matches, `WARNING: unable to read the token of the target, sending requests without it: credential helper ".*/helper" failed to get the token: vault is sealed\n`)
+}
+
+func (s *S) TestCredentialAgent(c *check.C) {
+	defer tokenHome(c, nil)()
+	key := strings.Repeat("ab", 32)
+	baseManager := cmd.BuildBaseManager("glb", "1.0.0", "Supported-Tsuru", nil)
+	command := baseManager.Commands["credential-agent"]
+	command.(cmd.FlaggedCommand).Flags().Parse(true, []string{"--ttl", "1m"})
+	context := cmd.Context{Stdin: strings.NewReader(key + "\n"), Stdout: ioutil.Discard, Stderr: ioutil.Discard}
+	done := make(chan error)
+	go func() {
+		done <- command.Run(&context, nil)
+	}()
+	socketPath := cmd.JoinWithUserDir(".tsuru", "agent", "agent.sock")
+	request := func(command string) string {
+		conn, err := net.Dial("unix", socketPath)
+		c.Assert(err, check.IsNil)
+		defer conn.Close()
+		fmt.Fprintln(conn, command)
+		reply, err := ioutil.ReadAll(conn)
+		c.Assert(err, check.IsNil)
+		return string(reply)
+	}
+	for i := 0; i < 100; i++ {
+		if _, err := os.Stat(socketPath); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	info, err := os.Stat(socketPath)
+	c.Assert(err, check.IsNil)
+	c.Assert(info.Mode().Perm(), check.Equals, os.FileMode(0600))
+	info, err = os.Stat(filepath.Dir(socketPath))
+	c.Assert(err, check.IsNil)
+	c.Assert(info.Mode().Perm(), check.Equals, os.FileMode(0700))
+	c.Assert(request("get"), check.Equals, key+"\n")
+	c.Assert(request("stop"), check.Equals, "ok\n")
+	select {
+	case err = <-done:
+		c.Assert(err, check.IsNil)
+	case <-time.After(5 * time.Second):
+		c.Fatal("agent did not stop")
+	}
+	_, err = os.Stat(socketPath)
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+}
+
+func (s *S) TestCredentialAgentInvalidKey(c *check.C) {
+	defer tokenHome(c, nil)()
+	baseManager := cmd.BuildBaseManager("glb", "1.0.0", "Supported-Tsuru", nil)
+	context := cmd.Context{Stdin: strings.NewReader("not a key\n")}
+	err := baseManager.Commands["credential-agent"].Run(&context, nil)
+	c.Assert(err, check.ErrorMatches, "invalid key")
+}
+
+// oauthServer is a tsuru API using OAuth, which is also the authorization
+// server, supporting the device authorization grant when device is true.
+// The device flow is authorized after the token is polled pending times.
+type oauthServer struct {
+	*httptest.Server
+	device  bool
+	pending int
+	polls   int
+}
+
+func newOAuthServer(device bool, pending int) *oauthServer {
+	s := &oauthServer{device: device, pending: pending}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+	return s
+}
+
+func (s *oauthServer) handle(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	switch r.URL.Path {
+	case "/1.0/auth/scheme":
+		data := map[string]string{
+			"authorizeUrl": s.URL + "/authorize?redirect_uri=__redirect_url__",
+			"port":         "4242",
+		}
+		if s.device {
+			data["deviceAuthorizationUrl"] = s.URL + "/device"
+			data["tokenUrl"] = s.URL + "/token"
+			data["clientId"] = "tsuru-cli"
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"name": "oauth", "data": data})
+	case "/1.0/auth/login":
+		if r.FormValue("accessToken") == "device-token" {
+			w.Write([]byte(`{"token":"tsuru-device-token"}`))
+			return
+		}
+		if r.FormValue("code") != "the-code" || r.FormValue("redirectUrl") != "http://localhost:4242" {
+			http.Error(w, "invalid code", http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"token":"tsuru-token"}`))
+	case "/device":
+		if r.FormValue("client_id") != "tsuru-cli" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_client"}`))
+			return
+		}
+		w.Write([]byte(`{"device_code":"dev-123","user_code":"WDJB-MJHT","verification_uri":"https://auth.example.com/device",
+"verification_uri_complete":"https://auth.example.com/device?user_code=WDJB-MJHT","expires_in":600,"interval":0}`))
+	case "/token":
+		if r.FormValue("grant_type") != "urn:ietf:params:oauth:grant-type:device_code" || r.FormValue("device_code") != "dev-123" {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		s.polls++
+		if s.polls <= s.pending {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"authorization_pending"}`))
+			return
+		}
+		if s.pending < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"access_denied"}`))
+			return
+		}
+		w.Write([]byte(`{"access_token":"device-token","token_type":"Bearer"}`))
+	}
+}
+
+func runLogin(c *check.C, target, input string, args ...string) (string, error) {
+	os.Setenv("TSURU_TARGET", target)
+	baseManager := cmd.BuildBaseManager("glb", "1.0.0", "Supported-Tsuru", nil)
+	command := baseManager.Commands["login"]
+	err := command.(cmd.FlaggedCommand).Flags().Parse(true, args)
+	c.Assert(err, check.IsNil)
+	var stdout bytes.Buffer
+	context := cmd.Context{
+		Args:   command.(cmd.FlaggedCommand).Flags().Args(),
+		Stdout: &stdout,
+		Stderr: &stdout,
+		Stdin:  strings.NewReader(input),
+	}
+	err = command.Run(&context, cmd.NewClient(&http.Client{}, &context, baseManager))
+	return stdout.String(), err
+}
+
+func (s *S) TestLoginNoBrowserPastedAddress(c *check.C) {
+	server := newOAuthServer(false, 0)
+	defer server.Close()
+	defer tokenHome(c, map[string]string{"prod": server.URL})()
+	out, err := runLogin(c, server.URL, "http://localhost:4242/?code=the-code&state=x\n", "--no-browser")
+	c.Assert(err, check.IsNil)
+	expected := fmt.Sprintf(`Open the following URL in a browser to log in:
+
+    %s/authorize?redirect_uri=http://localhost:4242
+
+After logging in, the browser will be redirected to an address that fails to load.
+Paste that address, or the code in it, here: 
+Successfully logged in!
+`, server.URL)
+	c.Assert(out, check.Equals, expected)
+	c.Assert(readTokenOf(c, server.URL), check.Equals, "tsuru-token")
+}
+
+func (s *S) TestLoginUsesTheHTTPClientOfTheTarget(c *check.C) {
+	server := &oauthServer{}
+	server.Server = httptest.NewTLSServer(http.HandlerFunc(server.handle))
+	defer server.Close()
+	defer tokenHome(c, map[string]string{"prod": server.URL})()
+	os.Setenv("TSURU_TARGET", server.URL)
+	baseManager := cmd.BuildBaseManager("glb", "1.0.0", "Supported-Tsuru", nil)
+	command := baseManager.Commands["login"]
+	err := command.(cmd.FlaggedCommand).Flags().Parse(true, []string{"--no-browser"})
+	c.Assert(err, check.IsNil)
+	var stdout bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stdout, Stdin: strings.NewReader("the-code\n")}
+	// The certificate of the server is only trusted by the client of the
+	// target, as configured by target-add.
+	httpClient := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	err = command.Run(&context, cmd.NewClient(httpClient, &context, baseManager))
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Matches, "(?s)Open the following URL in a browser to log in.*Successfully logged in!\n")
+	c.Assert(readTokenOf(c, server.URL), check.Equals, "tsuru-token")
+}
+
+func (s *S) TestLoginNoBrowserPastedCode(c *check.C) {
+	server := newOAuthServer(false, 0)
+	defer server.Close()
+	defer tokenHome(c, map[string]string{"prod": server.URL})()
+	_, err := runLogin(c, server.URL, "  the-code  \n", "--no-browser")
+	c.Assert(err, check.IsNil)
+	c.Assert(readTokenOf(c, server.URL), check.Equals, "tsuru-token")
+}
+
+func (s *S) TestLoginNoBrowserErrors(c *check.C) {
+	server := newOAuthServer(false, 0)
+	defer server.Close()
+	defer tokenHome(c, map[string]string{"prod": server.URL})()
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{"", "You must provide the code!"},
+		{"http://localhost:4242/?state=x", "the pasted address has no code"},
+		{"http://localhost:4242/?error=access_denied&error_description=User+said+no", "authorization failed: access_denied: User said no"},
+		{"wrong-code", "Error during login: invalid code"},
+	}
+	for _, t := range tests {
+		_, err := runLogin(c, server.URL, t.input+"\n", "--no-browser")
+		c.Check(err, check.ErrorMatches, t.err, check.Commentf("input %q", t.input))
+	}
+	c.Assert(readTokenOf(c, server.URL), check.Equals, "")
+}
+
+func (s *S) TestLoginNoBrowserDeviceFlow(c *check.C) {
+	server := newOAuthServer(true, 2)
+	defer server.Close()
+	defer tokenHome(c, map[string]string{"prod": server.URL})()
+	out, err := runLogin(c, server.URL, "", "--no-browser")
+	c.Assert(err, check.IsNil)
+	expected := `To log in, open https://auth.example.com/device in a browser and enter the code WDJB-MJHT
+or open https://auth.example.com/device?user_code=WDJB-MJHT
+
+Waiting for the authorization...
+Successfully logged in!
+`
+	c.Assert(out, check.Equals, expected)
+	c.Assert(server.polls, check.Equals, 3)
+	c.Assert(readTokenOf(c, server.URL), check.Equals, "tsuru-device-token")
+}
+
+func (s *S) TestLoginNoBrowserDeviceFlowDenied(c *check.C) {
+	server := newOAuthServer(true, -1)
+	defer server.Close()
+	defer tokenHome(c, map[string]string{"prod": server.URL})()
+	_, err := runLogin(c, server.URL, "", "--no-browser")
+	c.Assert(err, check.ErrorMatches, "the login was denied")
+	c.Assert(readTokenOf(c, server.URL), check.Equals, "")
+}
+
+func (s *S) TestReadTokenFromTokenFile(c *check.C) {
+	defer tokenHome(c, map[string]string{"prod": "https://prod.example.com"})()
+	defer os.Unsetenv("TSURU_TOKEN_FILE")
+	path := filepath.Join(c.MkDir(), "token")
+	err := ioutil.WriteFile(path, []byte("  file-token\n"), 0600)
+	c.Assert(err, check.IsNil)
+	os.Setenv("TSURU_TOKEN_FILE", path)
+	c.Assert(readTokenOf(c, "https://prod.example.com"), check.Equals, "file-token")
+	os.Setenv("TSURU_TOKEN", "env-token")
+	c.Assert(readTokenOf(c, "https://prod.example.com"), check.Equals, "env-token")
+	os.Unsetenv("TSURU_TOKEN")
+	err = ioutil.WriteFile(path, []byte("\n"), 0600)
+	c.Assert(err, check.IsNil)
+	_, err = cmd.ReadToken()
+	c.Assert(err, check.ErrorMatches, "the token file .* is empty")
+	os.Setenv("TSURU_TOKEN_FILE", path+".missing")
+	_, err = cmd.ReadToken()
+	c.Assert(err, check.ErrorMatches, "unable to read the token file: .*")
+}
+
+func (s *S) TestLoginPasswordStdin(c *check.C) {
+	var password string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/1.0/auth/scheme":
+			w.Write([]byte(`{"name":"native","data":{}}`))
+		case "/1.0/users/me@example.com/tokens":
+			password = r.FormValue("password")
+			w.Write([]byte(`{"token":"stdin-token"}`))
+		}
+	}))
+	defer server.Close()
+	defer tokenHome(c, map[string]string{"prod": server.URL})()
+	out, err := runLogin(c, server.URL, "s3cr3t pass\n", "--password-stdin", "me@example.com")
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Equals, "Successfully logged in!\n")
+	c.Assert(password, check.Equals, "s3cr3t pass")
+	c.Assert(readTokenOf(c, server.URL), check.Equals, "stdin-token")
+}
+
+func (s *S) TestLoginPasswordStdinErrors(c *check.C) {
+	server := loginServer()
+	defer server.Close()
+	defer tokenHome(c, map[string]string{"prod": server.URL})()
+	_, err := runLogin(c, server.URL, "secret\n", "--password-stdin")
+	c.Assert(err, check.ErrorMatches, "You must provide the email when using --password-stdin.")
+	_, err = runLogin(c, server.URL, "", "--password-stdin", "me@example.com")
+	c.Assert(err, check.ErrorMatches, "You must provide the password!")
+	oauth := newOAuthServer(false, 0)
+	defer oauth.Close()
+	_, err = runLogin(c, oauth.URL, "secret\n", "--password-stdin", "me@example.com")
+	c.Assert(err, check.ErrorMatches, `--password-stdin is only supported by the native authentication scheme, the scheme of the target is "oauth".`)
+}
+
+func (s *S) TestLoginNonInteractive(c *check.C) {
+	server := loginServer()
+	defer server.Close()
+	defer tokenHome(c, map[string]string{"prod": server.URL})()
+	os.Setenv("TSURU_TARGET", server.URL)
+	baseManager := cmd.BuildBaseManager("glb", "1.0.0", "Supported-Tsuru", nil)
+	var stdout bytes.Buffer
+	context := cmd.Context{
+		Args:           []string{"me@example.com"},
+		Stdout:         &stdout,
+		Stderr:         &stdout,
+		Stdin:          strings.NewReader("secret\n"),
+		NonInteractive: true,
+	}
+	command := baseManager.Commands["login"]
+	err := command.Run(&context, cmd.NewClient(&http.Client{}, &context, baseManager))
+	c.Assert(err, check.ErrorMatches, `unable to ask "Password" in non-interactive mode, use --password-stdin to answer it`)
+	c.Assert(stdout.String(), check.Equals, "")
+	err = command.(cmd.FlaggedCommand).Flags().Parse(true, []string{"--password-stdin", "me@example.com"})
+	c.Assert(err, check.IsNil)
+	err = command.Run(&context, cmd.NewClient(&http.Client{}, &context, baseManager))
+	c.Assert(err, check.IsNil)
+	c.Assert(readTokenOf(c, server.URL), check.Equals, "token-127.0.0.1")
+}
+
+// versionServer is a tsuru API reporting the given version in /info, or not
+// having the endpoint when the version is empty.
+type versionServer struct {
+	*httptest.Server
+	version string
+	calls   int32
+}
+
+func newVersionServer(version string) *versionServer {
+	s := &versionServer{version: version}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Supported-Tsuru", "0.9.0")
+		switch r.URL.Path {
+		case "/1.0/info":
+			atomic.AddInt32(&s.calls, 1)
+			if s.version == "" {
+				http.NotFound(w, r)
+				return
+			}
+			w.Write([]byte(`{"version":"` + s.version + `"}`))
+		case "/1.0/users/info":
+			if r.Header.Get("Authorization") != "bearer the-token" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			w.Write([]byte(`{"Email":"me@example.com"}`))
+		}
+	}))
+	return s
+}
+
+func versionClient(server *versionServer) *cmd.Client {
+	os.Setenv("TSURU_TARGET", server.URL)
+	context := cmd.Context{Stdout: ioutil.Discard, Stderr: ioutil.Discard}
+	return cmd.NewClient(&http.Client{}, &context, cmd.NewManager("glb", "1.0.0", "Supported-Tsuru", ioutil.Discard, ioutil.Discard, nil, nil))
+}
+
+func (s *S) TestAPIVersionDiscovery(c *check.C) {
+	defer tokenHome(c, nil)()
+	defer os.Setenv("TSURU_API_VERSION", os.Getenv("TSURU_API_VERSION"))
+	os.Unsetenv("TSURU_API_VERSION")
+	server := newVersionServer("1.2.5")
+	defer server.Close()
+	client := versionClient(server)
+	version, err := client.APIVersion()
+	c.Assert(err, check.IsNil)
+	c.Assert(version, check.Equals, "1.2")
+	u, err := client.URLVersion("/node", "1.3", "1.2")
+	c.Assert(err, check.IsNil)
+	c.Assert(u, check.Equals, server.URL+"/1.2/node")
+	u, err = client.URLVersion("/events", "1.1")
+	c.Assert(err, check.IsNil)
+	c.Assert(u, check.Equals, server.URL+"/1.1/events")
+	_, err = client.URLVersion("/routers", "1.3")
+	c.Assert(err, check.ErrorMatches, `this command requires the version 1.3 of the API, but the tsuru server \(.*\) serves up to the version 1.2`)
+	c.Assert(atomic.LoadInt32(&server.calls), check.Equals, int32(1))
+	data, err := ioutil.ReadFile(cmd.JoinWithUserDir(".tsuru", "versions"))
+	c.Assert(err, check.IsNil)
+	c.Assert(string(data), check.Matches, `\{"`+server.URL+`":\{"Version":"1.2.5","CheckedAt":".*"\}\}`)
+	os.Setenv("TSURU_API_VERSION_TTL", "0s")
+	defer os.Unsetenv("TSURU_API_VERSION_TTL")
+	_, err = client.APIVersion()
+	c.Assert(err, check.IsNil)
+	c.Assert(atomic.LoadInt32(&server.calls), check.Equals, int32(2))
+	os.Setenv("TSURU_API_VERSION", "1.3")
+	u, err = client.URLVersion("/routers", "1.3")
+	c.Assert(err, check.IsNil)
+	c.Assert(u, check.Equals, server.URL+"/1.3/routers")
+	c.Assert(atomic.LoadInt32(&server.calls), check.Equals, int32(2))
+}
+
+func (s *S) TestAPIVersionUnknown(c *check.C) {
+	defer tokenHome(c, nil)()
+	defer os.Setenv("TSURU_API_VERSION", os.Getenv("TSURU_API_VERSION"))
+	os.Unsetenv("TSURU_API_VERSION")
+	server := newVersionServer("")
+	defer server.Close()
+	client := versionClient(server)
+	version, err := client.APIVersion()
+	c.Assert(err, check.IsNil)
+	c.Assert(version, check.Equals, "")
+	u, err := client.URLVersion("/node", "1.2", "1.3")
+	c.Assert(err, check.IsNil)
+	c.Assert(u, check.Equals, server.URL+"/1.3/node")
+	u, err = client.URLVersion("/routers", "1.3")
+	c.Assert(err, check.IsNil)
+	c.Assert(u, check.Equals, server.URL+"/1.3/routers")
+	u, err = client.URLVersion("/apps")
+	c.Assert(err, check.IsNil)
+	c.Assert(u, check.Equals, server.URL+"/1.0/apps")
+	c.Assert(atomic.LoadInt32(&server.calls), check.Equals, int32(1))
+}
+
+func (s *S) TestAPIVersionDiscoveryFailure(c *check.C) {
+	defer tokenHome(c, nil)()
+	defer os.Setenv("TSURU_API_VERSION", os.Getenv("TSURU_API_VERSION"))
+	os.Unsetenv("TSURU_API_VERSION")
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		http.Error(w, "something went wrong", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	client := versionClient(&versionServer{Server: server})
+	_, err := client.APIVersion()
+	c.Assert(err, check.ErrorMatches, "something went wrong\n")
+	u, err := client.URLVersion("/node", "1.2", "1.0")
+	c.Assert(err, check.IsNil)
+	c.Assert(u, check.Equals, server.URL+"/1.2/node")
+	u, err = client.URLVersion("/routers", "1.3")
+	c.Assert(err, check.IsNil)
+	c.Assert(u, check.Equals, server.URL+"/1.3/routers")
+	c.Assert(atomic.LoadInt32(&calls), check.Equals, int32(1))
+	_, err = os.Stat(cmd.JoinWithUserDir(".tsuru", "versions"))
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+}
+
+func (s *S) TestTargetCheck(c *check.C) {
+	server := newVersionServer("1.4.2")
+	defer server.Close()
+	defer tokenHome(c, map[string]string{"prod": server.URL})()
+	os.Setenv("TSURU_TOKEN", "the-token")
+	out, err := runBaseCommand(c, "target-check", server.URL)
+	c.Assert(err, check.IsNil)
+	c.Assert(out, check.Matches, `Target:         prod \(`+server.URL+`\)
+Reachable:      yes \(.*\)
+TLS:            not used
+Server version: 1.4.2 \(API 1.4\)
+Client version: 1.0.0, supported
+Token:          valid
+User:           me@example.com
+`)
+}
+
+func (s *S) TestTargetCheckFailures(c *check.C) {
+	server := newVersionServer("")
+	defer server.Close()
+	defer tokenHome(c, map[string]string{"prod": server.URL})()
+	os.Setenv("TSURU_TOKEN", "expired-token")
+	out, err := runBaseCommand(c, "target-check", server.URL)
+	c.Assert(err, check.ErrorMatches, "target check failed: unauthorized")
+	c.Assert(out, check.Matches, `(?s).*Server version: unknown, the server doesn't report its version
+Client version: 1.0.0, supported
+Token:          invalid, expired or missing, please use "login"
+`)
+	server.Close()
+	out, err = runBaseCommand(c, "target-check", server.URL)
+	c.Assert(err, check.ErrorMatches, `target check failed: Failed to connect to tsuru server \(.*\), it's probably down.`)
+	c.Assert(out, check.Matches, `Target:         prod \(.*\)
+Reachable:      no, Failed to connect to tsuru server \(.*\), it's probably down.
+`)
+}
+
+func (s *S) TestVerboseDumpRedactsSecrets(c *check.C) {
+	var stdout bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stdout}
+	client := cmd.NewClient(&http.Client{
+		Transport: &cmdtest.Transport{
+			Message: `{"token":"issued-token","user":{"email":"me@example.com","password":"hash"}}`,
+			Status:  http.StatusOK,
+			Headers: map[string][]string{"Content-Type": {"application/json"}, "Set-Cookie": {"session=abc"}},
+		},
+	}, &context, manager)
+	client.Verbosity = 2
+	send := func(uri, body string) string {
+		stdout.Reset()
+		request, err := http.NewRequest("POST", "http://localhost:8080"+uri, strings.NewReader(body))
+		c.Assert(err, check.IsNil)
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		_, err = client.Do(request)
+		c.Assert(err, check.IsNil)
+		return stdout.String()
+	}
+	out := send("/1.0/users/me@example.com/tokens?token=query-token&lines=10", "password=secret-password&email=me%40example.com")
+	c.Assert(out, check.Matches, `(?s).*POST /1.0/users/me@example.com/tokens\?lines=10&token=REDACTED HTTP/1.1\r\n.*`)
+	c.Assert(out, check.Matches, `(?s).*Authorization: bearer REDACTED\r\n.*`)
+	c.Assert(out, check.Matches, `(?s).*email=me%40example.com&password=REDACTED\n.*`)
+	c.Assert(out, check.Matches, `(?s).*Set-Cookie: REDACTED\r\n.*`)
+	c.Assert(out, check.Matches, `(?s).*\{"token":"REDACTED","user":\{"email":"me@example.com","password":"REDACTED"\}\}\n.*`)
+	for _, secret := range []string{"sometoken", "query-token", "secret-password", "issued-token", "hash", "abc"} {
+		c.Assert(strings.Contains(out, secret), check.Equals, false, check.Commentf(secret))
+	}
+	out = send("/1.0/apps/myapp/env", "Envs.0.Name=DATABASE_PASSWORD&Envs.0.Value=s3cr3t&Private=true")
+	c.Assert(out, check.Matches, `(?s).*Envs.0.Name=DATABASE_PASSWORD&Envs.0.Value=REDACTED&Private=true\n.*`)
+	out = send("/1.0/apps/myapp/env", "Envs.0.Name=LOG_LEVEL&Envs.0.Value=debug&Private=false")
+	c.Assert(out, check.Matches, `(?s).*Envs.0.Name=LOG_LEVEL&Envs.0.Value=debug&Private=false\n.*`)
+	out = send("/1.0/install/hosts", "name=host1&sshPrivateKey=ssh-key&caCert=ca-cert&caPrivateKey=ca-key")
+	c.Assert(out, check.Matches, `(?s).*caCert=ca-cert&caPrivateKey=REDACTED&name=host1&sshPrivateKey=REDACTED\n.*`)
+	client.VerboseUnsafe = true
+	out = send("/1.0/apps/myapp/env", "Envs.0.Name=DATABASE_PASSWORD&Envs.0.Value=s3cr3t&Private=true")
+	c.Assert(out, check.Matches, `(?s).*Authorization: bearer sometoken\r\n.*`)
+	c.Assert(out, check.Matches, `(?s).*Envs.0.Name=DATABASE_PASSWORD&Envs.0.Value=s3cr3t&Private=true\n.*`)
+	c.Assert(out, check.Matches, `(?s).*\{"token":"issued-token".*`)
+}
@@ -0,0 +1,234 @@
+// Copyright 2017 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tsuru/gnuflag"
+	"github.com/tsuru/tsuru/cmd"
+	tsuruNet "github.com/tsuru/tsuru/net"
+)
+
+type AppDeployBlueGreen struct {
+	apps      cmd.StringSliceFlag
+	cname     string
+	image     string
+	message   string
+	smokePath string
+	timeout   time.Duration
+	force     bool
+	cnameOnly bool
+	revert    bool
+	fs        *gnuflag.FlagSet
+}
+
+func (c *AppDeployBlueGreen) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-deploy-bluegreen",
+		Usage: "app-deploy-bluegreen -a/--app <blue> -a/--app <green> [--cname cname] [-i/--image <image_url>] [-m/--message <message>] [--smoke-path path] [--timeout duration] [-f/--force] [-c/--cname-only] [--revert] [file-or-dir-1] ... [file-or-dir-n]",
+		Desc: `Deploys to the idle app of a blue-green pair and swaps the routing between
+them once the deploy is healthy.
+
+The live app is the one owning the public cname, given by [[--cname]]. When
+the flag is omitted, the live app is the only app of the pair with cnames.
+The files, or the image given by [[--image]], are deployed to the other (idle)
+app. After the deploy, the command waits for all units of the idle app to be
+started and, when [[--smoke-path]] is given, requests the path in the address
+of the idle app, expecting a successful HTTP status. Only then both apps are
+swapped (see [[tsuru app-swap]]).
+
+The previous live app is kept untouched, so the change can be reverted with
+[[--revert]], which swaps the apps back without deploying anything. The revert
+is only done when all units of the app being swapped back are started and,
+when [[--smoke-path]] is given, when its smoke check succeeds.`,
+		MinArgs: 0,
+	}
+}
+
+func (c *AppDeployBlueGreen) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("app-deploy-bluegreen", gnuflag.ExitOnError)
+		appMessage := "The name of the app. Must be used twice, for the blue and the green apps"
+		c.fs.Var(&c.apps, "app", appMessage)
+		c.fs.Var(&c.apps, "a", appMessage)
+		c.fs.StringVar(&c.cname, "cname", "", "The public cname, used to detect the live app")
+		image := "The image to deploy in app"
+		c.fs.StringVar(&c.image, "image", "", image)
+		c.fs.StringVar(&c.image, "i", "", image)
+		message := "A message describing this deploy"
+		c.fs.StringVar(&c.message, "message", "", message)
+		c.fs.StringVar(&c.message, "m", "", message)
+		c.fs.StringVar(&c.smokePath, "smoke-path", "", "Path requested in the idle app address before swapping, must return a successful status")
+		c.fs.DurationVar(&c.timeout, "timeout", 10*time.Minute, "Maximum time to wait for the units of the idle app to start")
+		force := "Force swap among apps with different number of units or different platform."
+		c.fs.BoolVar(&c.force, "force", false, force)
+		c.fs.BoolVar(&c.force, "f", false, force)
+		cnameOnly := "Swap all cnames except the default cname."
+		c.fs.BoolVar(&c.cnameOnly, "cname-only", false, cnameOnly)
+		c.fs.BoolVar(&c.cnameOnly, "c", false, cnameOnly)
+		c.fs.BoolVar(&c.revert, "revert", false, "Swap the apps back, without deploying")
+	}
+	return c.fs
+}
+
+func (c *AppDeployBlueGreen) Run(context *cmd.Context, client *cmd.Client) error {
+	context.RawOutput()
+	if len(c.apps) != 2 || c.apps[0] == c.apps[1] {
+		return errors.New("You must specify two different apps using the -a/--app flag twice.")
+	}
+	if c.revert && (c.image != "" || len(context.Args) > 0) {
+		return errors.New("You can't deploy when reverting a blue-green deploy.")
+	}
+	live, idle, err := c.detectLive(client)
+	if err != nil {
+		return err
+	}
+	if c.revert {
+		if !allUnitsStarted(idle) {
+			renderUnitCounts(context.Stdout, idle)
+			return fmt.Errorf("The units of %q are not all started. The apps were not swapped.", idle.Name)
+		}
+		if err = c.runSmokeCheck(context, idle); err != nil {
+			return err
+		}
+		fmt.Fprintf(context.Stdout, "Reverting: swapping %q (live) and %q.\n", live.Name, idle.Name)
+		if err = c.swap(client, live.Name, idle.Name); err != nil {
+			return err
+		}
+		fmt.Fprintf(context.Stdout, "Apps successfully swapped, %q is live again.\n", idle.Name)
+		return nil
+	}
+	fmt.Fprintf(context.Stdout, "Live app is %q, deploying to %q.\n", live.Name, idle.Name)
+	deploy := AppDeploy{}
+	deploy.Flags().Parse(true, []string{"-a", idle.Name})
+	deploy.image = c.image
+	deploy.message = c.message
+	if err = deploy.Run(context, client); err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "\nWaiting for the units of %q to start...\n", idle.Name)
+	a, err := waitForUnits(context, client, idle.Name, c.timeout, allUnitsStarted)
+	if err != nil {
+		if a != nil {
+			renderUnitCounts(context.Stdout, a)
+		}
+		return fmt.Errorf("%s. The apps were not swapped.", err)
+	}
+	if err = c.runSmokeCheck(context, a); err != nil {
+		return err
+	}
+	if err = c.swap(client, live.Name, idle.Name); err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "Apps successfully swapped, %q is now live.\n", idle.Name)
+	fmt.Fprintf(context.Stdout, "To revert, run: tsuru app-deploy-bluegreen -a %s -a %s --revert\n", c.apps[0], c.apps[1])
+	return nil
+}
+
+// runSmokeCheck runs the smoke check in the address of the app, when
+// --smoke-path is given.
+func (c *AppDeployBlueGreen) runSmokeCheck(context *cmd.Context, a *app) error {
+	if c.smokePath == "" {
+		return nil
+	}
+	fmt.Fprintf(context.Stdout, "Running smoke check against %q...\n", a.IP)
+	if err := smokeCheck(context, a.IP, c.smokePath); err != nil {
+		return fmt.Errorf("smoke check failed: %s. The apps were not swapped.", err)
+	}
+	return nil
+}
+
+// detectLive returns the app of the pair currently owning the public cname,
+// and the idle one.
+func (c *AppDeployBlueGreen) detectLive(client *cmd.Client) (*app, *app, error) {
+	var apps [2]*app
+	for i, name := range c.apps {
+		a, err := loadApp(client, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		apps[i] = a
+	}
+	var owners []int
+	for i, a := range apps {
+		if c.cname != "" {
+			if in(c.cname, a.CName) {
+				owners = append(owners, i)
+			}
+		} else if len(a.CName) > 0 {
+			owners = append(owners, i)
+		}
+	}
+	if len(owners) != 1 {
+		if c.cname != "" {
+			return nil, nil, fmt.Errorf("Unable to find which app owns the cname %q.", c.cname)
+		}
+		return nil, nil, errors.New("Unable to detect the live app, please use the --cname flag.")
+	}
+	return apps[owners[0]], apps[1-owners[0]], nil
+}
+
+func (c *AppDeployBlueGreen) swap(client *cmd.Client, app1, app2 string) error {
+	v := url.Values{}
+	v.Set("app1", app1)
+	v.Set("app2", app2)
+	v.Set("force", strconv.FormatBool(c.force))
+	v.Set("cnameOnly", strconv.FormatBool(c.cnameOnly))
+	u, err := cmd.GetURL("/swap")
+	if err != nil {
+		return err
+	}
+	return makeSwap(client, u, strings.NewReader(v.Encode()))
+}
+
+func allUnitsStarted(a *app) bool {
+	units := a.processUnits()
+	if len(units) == 0 {
+		return false
+	}
+	for _, processUnits := range units {
+		for _, u := range processUnits {
+			if !u.Available() {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// smokeCheck requests the given path in the address, returning an error
+// unless the response has a successful status.
+func smokeCheck(context *cmd.Context, address, path string) error {
+	if !strings.HasPrefix(address, "http://") && !strings.HasPrefix(address, "https://") {
+		address = "http://" + address
+	}
+	u := strings.TrimRight(address, "/") + "/" + strings.TrimLeft(path, "/")
+	response, err := getAddress(context, u)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < http.StatusOK || response.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("GET %s returned %s", u, response.Status)
+	}
+	return nil
+}
+
+// getAddress requests the address of an app, outside of the API, canceling
+// the request with the command.
+func getAddress(context *cmd.Context, address string) (*http.Response, error) {
+	request, err := http.NewRequest("GET", address, nil)
+	if err != nil {
+		return nil, err
+	}
+	return tsuruNet.Dial5Full60ClientNoKeepAlive.Do(request.WithContext(context.Context()))
+}
@@ -0,0 +1,222 @@
+// Copyright 2017 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	"github.com/tsuru/tsuru/cmd"
+	"github.com/tsuru/tsuru/cmd/cmdtest"
+	"gopkg.in/check.v1"
+)
+
+func blueGreenTransport(c *check.C, greenIP string, swapped *bool, deployed *string) *cmdtest.AnyConditionalTransport {
+	blue := `{"name":"blue","ip":"blue.tsuru.io","cname":["www.example.com"],"units":[{"ID":"b1","Status":"started","ProcessName":"web"}]}`
+	green := `{"name":"green","ip":"` + greenIP + `","units":[{"ID":"g1","Status":"started","ProcessName":"web"}]}`
+	return &cmdtest.AnyConditionalTransport{
+		ConditionalTransports: []cmdtest.ConditionalTransport{
+			{
+				Transport: cmdtest.Transport{Message: blue, Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					return req.Method == "GET" && strings.HasSuffix(req.URL.Path, "/apps/blue")
+				},
+			},
+			{
+				Transport: cmdtest.Transport{Message: green, Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					return req.Method == "GET" && strings.HasSuffix(req.URL.Path, "/apps/green")
+				},
+			},
+			{
+				Transport: cmdtest.Transport{Message: "deploy worked\nOK\n", Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					if req.Method != "POST" || !strings.HasSuffix(req.URL.Path, "/deploy") {
+						return false
+					}
+					*deployed = req.URL.Path
+					c.Assert(req.FormValue("image"), check.Equals, "registry.example.com/app:v2")
+					return true
+				},
+			},
+			{
+				Transport: cmdtest.Transport{Message: "", Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					if req.Method != "POST" || !strings.HasSuffix(req.URL.Path, "/swap") {
+						return false
+					}
+					*swapped = true
+					c.Assert(req.FormValue("app1"), check.Equals, "blue")
+					c.Assert(req.FormValue("app2"), check.Equals, "green")
+					return true
+				},
+			},
+		},
+	}
+}
+
+func (s *S) TestAppDeployBlueGreenInfo(c *check.C) {
+	c.Assert((&AppDeployBlueGreen{}).Info(), check.NotNil)
+}
+
+func (s *S) TestAppDeployBlueGreenRun(c *check.C) {
+	var smokeCalled bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		smokeCalled = r.URL.Path == "/healthcheck"
+	}))
+	defer server.Close()
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	var swapped bool
+	var deployed string
+	trans := blueGreenTransport(c, strings.TrimPrefix(server.URL, "http://"), &swapped, &deployed)
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppDeployBlueGreen{}
+	command.Flags().Parse(true, []string{"-a", "blue", "-a", "green", "-i", "registry.example.com/app:v2", "--smoke-path", "/healthcheck"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(deployed, check.Equals, "/1.0/apps/green/deploy")
+	c.Assert(smokeCalled, check.Equals, true)
+	c.Assert(swapped, check.Equals, true)
+	c.Assert(stdout.String(), check.Matches, `(?s)Live app is "blue", deploying to "green".*Apps successfully swapped, "green" is now live.
+To revert, run: tsuru app-deploy-bluegreen -a blue -a green --revert
+`)
+}
+
+func (s *S) TestAppDeployBlueGreenSmokeCheckFailure(c *check.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	var swapped bool
+	var deployed string
+	trans := blueGreenTransport(c, strings.TrimPrefix(server.URL, "http://"), &swapped, &deployed)
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppDeployBlueGreen{}
+	command.Flags().Parse(true, []string{"-a", "blue", "-a", "green", "-i", "registry.example.com/app:v2", "--smoke-path", "healthcheck"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.ErrorMatches, `smoke check failed: GET .*/healthcheck returned 503 Service Unavailable. The apps were not swapped.`)
+	c.Assert(swapped, check.Equals, false)
+}
+
+func (s *S) TestAppDeployBlueGreenRevert(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	var swapped bool
+	var deployed string
+	trans := blueGreenTransport(c, "green.tsuru.io", &swapped, &deployed)
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppDeployBlueGreen{}
+	command.Flags().Parse(true, []string{"-a", "green", "-a", "blue", "--cname", "www.example.com", "--revert"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(deployed, check.Equals, "")
+	c.Assert(swapped, check.Equals, true)
+	c.Assert(stdout.String(), check.Equals, "Reverting: swapping \"blue\" (live) and \"green\".\nApps successfully swapped, \"green\" is live again.\n")
+}
+
+func (s *S) TestAppDeployBlueGreenRevertSmokeCheck(c *check.C) {
+	var smokeCalled bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		smokeCalled = true
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	var swapped bool
+	var deployed string
+	trans := blueGreenTransport(c, strings.TrimPrefix(server.URL, "http://"), &swapped, &deployed)
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppDeployBlueGreen{}
+	command.Flags().Parse(true, []string{"-a", "green", "-a", "blue", "--revert", "--smoke-path", "/healthcheck"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.ErrorMatches, `smoke check failed: GET .*/healthcheck returned 503 Service Unavailable. The apps were not swapped.`)
+	c.Assert(smokeCalled, check.Equals, true)
+	c.Assert(swapped, check.Equals, false)
+}
+
+func (s *S) TestAppDeployBlueGreenRevertUnitsNotStarted(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	var swapped bool
+	trans := &cmdtest.AnyConditionalTransport{
+		ConditionalTransports: []cmdtest.ConditionalTransport{
+			{
+				Transport: cmdtest.Transport{Message: `{"name":"blue","cname":["www.example.com"],"units":[{"ID":"b1","Status":"started","ProcessName":"web"}]}`, Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					return req.Method == "GET" && strings.HasSuffix(req.URL.Path, "/apps/blue")
+				},
+			},
+			{
+				Transport: cmdtest.Transport{Message: `{"name":"green","units":[{"ID":"g1","Status":"error","ProcessName":"web"}]}`, Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					return req.Method == "GET" && strings.HasSuffix(req.URL.Path, "/apps/green")
+				},
+			},
+			{
+				Transport: cmdtest.Transport{Message: "", Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					swapped = req.Method == "POST" && strings.HasSuffix(req.URL.Path, "/swap")
+					return swapped
+				},
+			},
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppDeployBlueGreen{}
+	command.Flags().Parse(true, []string{"-a", "green", "-a", "blue", "--revert"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.ErrorMatches, `The units of "green" are not all started. The apps were not swapped.`)
+	c.Assert(swapped, check.Equals, false)
+	c.Assert(stdout.String(), check.Matches, `(?s).*\| web +\| 1 +\| 1 error \|.*`)
+}
+
+func (s *S) TestAppDeployBlueGreenUnknownCname(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	var swapped bool
+	var deployed string
+	trans := blueGreenTransport(c, "green.tsuru.io", &swapped, &deployed)
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppDeployBlueGreen{}
+	command.Flags().Parse(true, []string{"-a", "blue", "-a", "green", "--cname", "other.example.com", "-i", "img"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.ErrorMatches, `Unable to find which app owns the cname "other.example.com".`)
+}
+
+func (s *S) TestAppDeployBlueGreenRequiresTwoApps(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	command := AppDeployBlueGreen{}
+	command.Flags().Parse(true, []string{"-a", "blue"})
+	err := command.Run(&context, nil)
+	c.Assert(err, check.ErrorMatches, "You must specify two different apps using the -a/--app flag twice.")
+}
@@ -0,0 +1,180 @@
+// Copyright 2017 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/tsuru/gnuflag"
+	"github.com/tsuru/tsuru/cmd"
+)
+
+const appSelectorHelp = `
+
+Instead of a single app, the command may run on all apps matching the
+[[--pool]], [[--team]], [[--platform]], [[--status]] and [[--tag]] filters,
+the same filters used by [[tsuru app-list]]. The affected apps are listed for
+confirmation (use [[-y]] to skip it), at most [[--workers]] apps are handled at
+the same time and a summary is displayed in the end. No new apps are handled
+after the first failure, unless [[--continue-on-error]] is used.`
+
+// appSelector allows a command to run against every app matching the same
+// filters used by app-list, instead of a single app.
+type appSelector struct {
+	cmd.ConfirmationCommand
+	filter          appFilter
+	workers         int
+	continueOnError bool
+}
+
+func (s *appSelector) flags(fs *gnuflag.FlagSet) *gnuflag.FlagSet {
+	fs.StringVar(&s.filter.pool, "pool", "", "Run on all applications in the given pool")
+	fs.StringVar(&s.filter.teamOwner, "team", "", "Run on all applications owned by the given team")
+	fs.StringVar(&s.filter.platform, "platform", "", "Run on all applications using the given platform")
+	fs.StringVar(&s.filter.status, "status", "", "Run on all applications with units in the given status. Accepts multiple values separated by commas")
+	fs.Var(&s.filter.tags, "tag", "Run on all applications with the given tag. Can be used multiple times")
+	fs.IntVar(&s.workers, "workers", 4, "Maximum number of applications handled concurrently when using filters")
+	fs.BoolVar(&s.continueOnError, "continue-on-error", false, "Keep going with the remaining applications when one of them fails")
+	return cmd.MergeFlagSet(fs, s.ConfirmationCommand.Flags())
+}
+
+// active reports whether any app filter was given in the command line.
+func (s *appSelector) active() bool {
+	f := s.filter
+	return f.pool != "" || f.teamOwner != "" || f.platform != "" || f.status != "" || len(f.tags) > 0
+}
+
+func (s *appSelector) apps(client *cmd.Client) ([]string, error) {
+	qs, err := s.filter.queryString(client)
+	if err != nil {
+		return nil, err
+	}
+	result, err := getFromURL(fmt.Sprintf("/apps?%s", qs.Encode()), client)
+	if err != nil {
+		return nil, err
+	}
+	var apps []app
+	if len(result) > 0 {
+		err = json.Unmarshal(result, &apps)
+		if err != nil {
+			return nil, err
+		}
+	}
+	names := make([]string, len(apps))
+	for i, a := range apps {
+		names[i] = a.Name
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+type appResult struct {
+	app    string
+	err    error
+	output bytes.Buffer
+}
+
+// run calls fn for each selected app, using at most s.workers concurrent
+// calls. The output of each app is buffered and written once the app is
+// done, followed by a summary of the results.
+func (s *appSelector) run(context *cmd.Context, client *cmd.Client, action string, fn func(*cmd.Context, string) error) error {
+	appNames, err := s.apps(client)
+	if err != nil {
+		return err
+	}
+	if len(appNames) == 0 {
+		fmt.Fprintln(context.Stdout, "No applications match the given filters.")
+		return nil
+	}
+	question := fmt.Sprintf("The following %d app(s) will be affected:\n\n  %s\n\nAre you sure you want to %s them?",
+		len(appNames), strings.Join(appNames, "\n  "), action)
+	if !s.Confirm(context, question) {
+		return nil
+	}
+	workers := s.workers
+	if workers < 1 {
+		workers = 1
+	}
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		aborted bool
+	)
+	results := make([]*appResult, len(appNames))
+	sem := make(chan struct{}, workers)
+	for i, appName := range appNames {
+		sem <- struct{}{}
+		mu.Lock()
+		stop := aborted
+		mu.Unlock()
+		if stop {
+			<-sem
+			break
+		}
+		result := &appResult{app: appName}
+		results[i] = result
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			appContext := context.WithStreams(&result.output, &result.output, bytes.NewReader(nil))
+			result.err = fn(appContext, result.app)
+			mu.Lock()
+			defer mu.Unlock()
+			if result.err != nil && !s.continueOnError {
+				aborted = true
+			}
+			fmt.Fprintf(context.Stdout, "==> %s\n", result.app)
+			context.Stdout.Write(result.output.Bytes())
+			if result.err != nil {
+				fmt.Fprintf(context.Stdout, "Error: %s\n", result.err)
+			}
+		}()
+	}
+	wg.Wait()
+	return renderAppResults(context, results)
+}
+
+func renderAppResults(context *cmd.Context, results []*appResult) error {
+	var failed, skipped int
+	table := cmd.NewTable()
+	table.Headers = cmd.Row([]string{"Application", "Result"})
+	for _, r := range results {
+		if r == nil {
+			skipped++
+			continue
+		}
+		status := "ok"
+		if r.err != nil {
+			failed++
+			status = "failed: " + strings.TrimSpace(r.err.Error())
+		}
+		table.AddRow(cmd.Row([]string{r.app, status}))
+	}
+	fmt.Fprintln(context.Stdout)
+	context.Stdout.Write(table.Bytes())
+	if skipped > 0 {
+		fmt.Fprintf(context.Stdout, "%d app(s) skipped after failure, use --continue-on-error to keep going.\n", skipped)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d app(s) failed", failed, table.Rows())
+	}
+	return nil
+}
+
+// checkSingleApp returns an error when the app flag is used together with
+// app filters.
+func (s *appSelector) checkSingleApp(fs *gnuflag.FlagSet) error {
+	if s.active() && fs.Lookup("app").Value.String() != "" {
+		return errors.New("You can't use the --app flag together with app filters.")
+	}
+	return nil
+}
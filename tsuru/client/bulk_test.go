@@ -0,0 +1,187 @@
+// Copyright 2017 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/tsuru/gnuflag"
+	"github.com/tsuru/tsuru/cmd"
+	"github.com/tsuru/tsuru/cmd/cmdtest"
+	"github.com/tsuru/tsuru/io"
+	"gopkg.in/check.v1"
+)
+
+func bulkTransport(c *check.C, appList string, failing map[string]bool) (*cmdtest.AnyConditionalTransport, *[]string) {
+	var restarted []string
+	ok, _ := json.Marshal(io.SimpleJsonMessage{Message: "restarted\n"})
+	failed, _ := json.Marshal(io.SimpleJsonMessage{Error: "restart failed"})
+	trans := &cmdtest.AnyConditionalTransport{
+		ConditionalTransports: []cmdtest.ConditionalTransport{
+			{
+				Transport: cmdtest.Transport{Message: appList, Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					if !strings.HasSuffix(req.URL.Path, "/apps") || req.Method != "GET" {
+						return false
+					}
+					c.Assert(req.URL.Query().Get("pool"), check.Equals, "prod")
+					c.Assert(req.URL.Query()["tag"], check.DeepEquals, []string{"payments"})
+					return true
+				},
+			},
+			{
+				Transport: cmdtest.Transport{Message: string(failed), Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					parts := strings.Split(req.URL.Path, "/")
+					return req.Method == "POST" && strings.HasSuffix(req.URL.Path, "/restart") && failing[parts[3]]
+				},
+			},
+			{
+				Transport: cmdtest.Transport{Message: string(ok), Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					if req.Method != "POST" || !strings.HasSuffix(req.URL.Path, "/restart") {
+						return false
+					}
+					restarted = append(restarted, strings.Split(req.URL.Path, "/")[3])
+					return true
+				},
+			},
+		},
+	}
+	return trans, &restarted
+}
+
+func (s *S) TestAppRestartWithFilters(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans, restarted := bulkTransport(c, `[{"name":"billing"},{"name":"api"}]`, nil)
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppRestart{}
+	command.Flags().Parse(true, []string{"--pool", "prod", "--tag", "payments", "--workers", "1", "-y"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(*restarted, check.DeepEquals, []string{"api", "billing"})
+	expected := `==> api
+restarted
+==> billing
+restarted
+
++-------------+--------+
+| Application | Result |
++-------------+--------+
+| api         | ok     |
+| billing     | ok     |
++-------------+--------+
+`
+	c.Assert(stdout.String(), check.Equals, expected)
+}
+
+func (s *S) TestAppRestartWithFiltersStopsOnError(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans, restarted := bulkTransport(c, `[{"name":"a1"},{"name":"a2"},{"name":"a3"}]`, map[string]bool{"a1": true})
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppRestart{}
+	command.Flags().Parse(true, []string{"--pool", "prod", "--tag", "payments", "--workers", "1", "-y"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.ErrorMatches, "1 of 1 app\\(s\\) failed")
+	c.Assert(*restarted, check.HasLen, 0)
+	c.Assert(stdout.String(), check.Matches, "(?s).*a1 .*failed: restart failed.*2 app\\(s\\) skipped after failure.*")
+}
+
+func (s *S) TestAppRestartWithFiltersContinueOnError(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans, restarted := bulkTransport(c, `[{"name":"a1"},{"name":"a2"},{"name":"a3"}]`, map[string]bool{"a2": true})
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppRestart{}
+	command.Flags().Parse(true, []string{"--pool", "prod", "--tag", "payments", "--workers", "1", "--continue-on-error", "-y"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.ErrorMatches, "1 of 3 app\\(s\\) failed")
+	c.Assert(*restarted, check.DeepEquals, []string{"a1", "a3"})
+	c.Assert(stdout.String(), check.Matches, "(?s).*\\| a2 +\\| failed: restart failed \\|.*")
+}
+
+func (s *S) TestAppRestartWithFiltersAskForConfirmation(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Stdin:  strings.NewReader("n\n"),
+	}
+	trans, restarted := bulkTransport(c, `[{"name":"billing"},{"name":"api"}]`, nil)
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppRestart{}
+	command.Flags().Parse(true, []string{"--pool", "prod", "--tag", "payments"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(*restarted, check.HasLen, 0)
+	expected := `The following 2 app(s) will be affected:
+
+  api
+  billing
+
+Are you sure you want to restart them? (y/n) Abort.
+`
+	c.Assert(stdout.String(), check.Equals, expected)
+}
+
+func (s *S) TestAppRestartWithFiltersNoApps(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: &cmdtest.Transport{Status: http.StatusNoContent}}, nil, manager)
+	command := AppStop{}
+	command.Flags().Parse(true, []string{"--team", "myteam"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "No applications match the given filters.\n")
+}
+
+func (s *S) TestAppRestartWithFiltersAndApp(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	command := AppStart{}
+	command.Flags().Parse(true, []string{"-a", "myapp", "--pool", "prod"})
+	err := command.Run(&context, nil)
+	c.Assert(err, check.ErrorMatches, "You can't use the --app flag together with app filters.")
+}
+
+func (s *S) TestAppSelectorRunKeepsNonInteractiveMode(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout:         &stdout,
+		Stderr:         &stderr,
+		NonInteractive: true,
+	}
+	trans, _ := bulkTransport(c, `[{"name":"billing"},{"name":"api"}]`, nil)
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	var selector appSelector
+	selector.flags(gnuflag.NewFlagSet("", gnuflag.ExitOnError)).Parse(true, []string{"--pool", "prod", "--tag", "payments", "-y"})
+	err := selector.run(&context, client, "check", func(appContext *cmd.Context, appName string) error {
+		c.Check(appContext.NonInteractive, check.Equals, true)
+		c.Check(appContext.Context(), check.Equals, context.Context())
+		return appContext.CheckInteractive("Continue?", "")
+	})
+	c.Assert(err, check.ErrorMatches, "2 of 2 app\\(s\\) failed")
+	c.Assert(stdout.String(), check.Matches, `(?s).*unable to ask "Continue\?" in non-interactive mode.*`)
+}
@@ -0,0 +1,140 @@
+// Copyright 2017 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/tsuru/tsuru/cmd"
+	"github.com/tsuru/tsuru/errors"
+	tsuruNet "github.com/tsuru/tsuru/net"
+)
+
+const unknownHost = "(unknown)"
+
+// showByNode shows the units of the app grouped by host, with the number of
+// units of each process in each host.
+func (c *AppInfo) showByNode(context *cmd.Context, client *cmd.Client, appName string) error {
+	a, err := loadApp(client, appName)
+	if err != nil {
+		return err
+	}
+	units := a.processUnits()
+	if len(units) == 0 {
+		fmt.Fprintf(context.Stdout, "App %q has no units.\n", appName)
+		return nil
+	}
+	processes := make([]string, 0, len(units))
+	counts := make(map[string]map[string]int)
+	for process, processUnits := range units {
+		processes = append(processes, process)
+		for _, u := range processUnits {
+			host := u.Host()
+			if host == "" {
+				host = unknownHost
+			}
+			if counts[host] == nil {
+				counts[host] = make(map[string]int)
+			}
+			counts[host][process]++
+		}
+	}
+	sort.Strings(processes)
+	hosts := make([]string, 0, len(counts))
+	for host := range counts {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	var metadata map[string]map[string]string
+	if len(c.nodeMetadata) > 0 {
+		metadata, err = nodesMetadata(client)
+		if err != nil {
+			e, ok := err.(*errors.HTTP)
+			if !ok || e.Code != http.StatusForbidden {
+				return err
+			}
+			fmt.Fprintln(context.Stderr, "WARNING: you're not allowed to list nodes, node metadata will not be shown.")
+		}
+	}
+	headers := append([]string{"Host", "Units"}, processes...)
+	if metadata != nil {
+		headers = append(headers, c.nodeMetadata...)
+	}
+	table := cmd.NewTable()
+	table.Headers = cmd.Row(headers)
+	for _, host := range hosts {
+		total := 0
+		row := []string{host, ""}
+		for _, process := range processes {
+			total += counts[host][process]
+			row = append(row, strconv.Itoa(counts[host][process]))
+		}
+		row[1] = strconv.Itoa(total)
+		if metadata != nil {
+			for _, key := range c.nodeMetadata {
+				row = append(row, metadata[host][key])
+			}
+		}
+		table.AddRow(cmd.Row(row))
+	}
+	fmt.Fprintf(context.Stdout, "Units of app %q by host:\n", appName)
+	context.Stdout.Write(table.Bytes())
+	for _, process := range processes {
+		total := len(units[process])
+		if total < 2 {
+			continue
+		}
+		for _, host := range hosts {
+			share := float64(counts[host][process]) * 100 / float64(total)
+			if share > c.maxShare {
+				fmt.Fprintf(context.Stdout, "WARNING: host %q holds %d of %d units (%.0f%%) of process %q.\n", host, counts[host][process], total, share, process)
+			}
+		}
+	}
+	return nil
+}
+
+// nodesMetadata returns the metadata of the nodes of the cluster, by host.
+func nodesMetadata(client *cmd.Client) (map[string]map[string]string, error) {
+	u, err := client.URLVersion("/node", "1.2")
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	metadata := make(map[string]map[string]string)
+	if response.StatusCode == http.StatusNoContent {
+		return metadata, nil
+	}
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Nodes []struct {
+			Address  string
+			Metadata map[string]string
+		}
+	}
+	if err = json.Unmarshal(data, &result); err != nil {
+		return nil, err
+	}
+	for _, node := range result.Nodes {
+		metadata[tsuruNet.URLToHost(node.Address)] = node.Metadata
+	}
+	return metadata, nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2017 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/tsuru/tsuru/cmd"
+	"github.com/tsuru/tsuru/cmd/cmdtest"
+	"gopkg.in/check.v1"
+)
+
+const byNodeApp = `{"name":"myapp","units":[
+{"ID":"u1","Status":"started","ProcessName":"web","Address":{"Host":"10.0.0.1:3333"}},
+{"ID":"u2","Status":"started","ProcessName":"web","Address":{"Host":"10.0.0.1:3334"}},
+{"ID":"u3","Status":"started","ProcessName":"web","Address":{"Host":"10.0.0.2:3333"}},
+{"ID":"u4","Status":"started","ProcessName":"worker","Address":{"Host":"10.0.0.2:3335"}},
+{"ID":"u5","Status":"pending","ProcessName":"worker"}
+]}`
+
+func byNodeTransport(nodesStatus int, nodes string) *cmdtest.AnyConditionalTransport {
+	return &cmdtest.AnyConditionalTransport{
+		ConditionalTransports: []cmdtest.ConditionalTransport{
+			{
+				Transport: cmdtest.Transport{Message: byNodeApp, Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					return req.URL.Path == "/1.0/apps/myapp"
+				},
+			},
+			{
+				Transport: cmdtest.Transport{Message: nodes, Status: nodesStatus},
+				CondFunc: func(req *http.Request) bool {
+					return req.URL.Path == "/1.2/node"
+				},
+			},
+		},
+	}
+}
+
+func (s *S) TestAppInfoByNode(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: byNodeTransport(http.StatusOK, "")}, nil, manager)
+	command := AppInfo{}
+	command.Flags().Parse(true, []string{"-a", "myapp", "--by-node"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	expected := `Units of app "myapp" by host:
++-----------+-------+-----+--------+
+| Host      | Units | web | worker |
++-----------+-------+-----+--------+
+| (unknown) | 1     | 0   | 1      |
+| 10.0.0.1  | 2     | 2   | 0      |
+| 10.0.0.2  | 2     | 1   | 1      |
++-----------+-------+-----+--------+
+WARNING: host "10.0.0.1" holds 2 of 3 units (67%) of process "web".
+`
+	c.Assert(stdout.String(), check.Equals, expected)
+}
+
+func (s *S) TestAppInfoByNodeMaxShareAndMetadata(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	nodes := `{"nodes":[
+{"Address":"http://10.0.0.1:2375","Status":"ready","Metadata":{"pool":"prod","zone":"a"}},
+{"Address":"http://10.0.0.2:2375","Status":"ready","Metadata":{"pool":"prod","zone":"b"}}
+]}`
+	client := cmd.NewClient(&http.Client{Transport: byNodeTransport(http.StatusOK, nodes)}, nil, manager)
+	command := AppInfo{}
+	command.Flags().Parse(true, []string{"-a", "myapp", "--by-node", "--max-share", "40", "--node-metadata", "zone"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	expected := `Units of app "myapp" by host:
++-----------+-------+-----+--------+------+
+| Host      | Units | web | worker | zone |
++-----------+-------+-----+--------+------+
+| (unknown) | 1     | 0   | 1      |      |
+| 10.0.0.1  | 2     | 2   | 0      | a    |
+| 10.0.0.2  | 2     | 1   | 1      | b    |
++-----------+-------+-----+--------+------+
+WARNING: host "10.0.0.1" holds 2 of 3 units (67%) of process "web".
+WARNING: host "(unknown)" holds 1 of 2 units (50%) of process "worker".
+WARNING: host "10.0.0.2" holds 1 of 2 units (50%) of process "worker".
+`
+	c.Assert(stdout.String(), check.Equals, expected)
+}
+
+func (s *S) TestAppInfoByNodeMetadataForbidden(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: byNodeTransport(http.StatusForbidden, "forbidden")}, nil, manager)
+	command := AppInfo{}
+	command.Flags().Parse(true, []string{"-a", "myapp", "--by-node", "--node-metadata", "pool"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stderr.String(), check.Equals, "WARNING: you're not allowed to list nodes, node metadata will not be shown.\n")
+	c.Assert(stdout.String(), check.Matches, `(?s).*\| Host +\| Units \| web \| worker \|\n.*`)
+}
@@ -65,7 +65,7 @@ func (c *CertificateSet) Run(context *cmd.Context, client *cmd.Client) error {
 	v.Set("cname", c.cname)
 	v.Set("certificate", string(cert))
 	v.Set("key", string(key))
-	u, err := cmd.GetURLVersion("1.2", fmt.Sprintf("/apps/%s/certificate", appName))
+	u, err := client.URLVersion(fmt.Sprintf("/apps/%s/certificate", appName), "1.2")
 	if err != nil {
 		return err
 	}
@@ -117,7 +117,7 @@ func (c *CertificateUnset) Run(context *cmd.Context, client *cmd.Client) error {
 	}
 	v := url.Values{}
 	v.Set("cname", c.cname)
-	u, err := cmd.GetURLVersion("1.2", fmt.Sprintf("/apps/%s/certificate?%s", appName, v.Encode()))
+	u, err := client.URLVersion(fmt.Sprintf("/apps/%s/certificate?%s", appName, v.Encode()), "1.2")
 	if err != nil {
 		return err
 	}
@@ -163,7 +163,7 @@ func (c *CertificateList) Run(context *cmd.Context, client *cmd.Client) error {
 	if err != nil {
 		return err
 	}
-	u, err := cmd.GetURLVersion("1.2", fmt.Sprintf("/apps/%s/certificate", appName))
+	u, err := client.URLVersion(fmt.Sprintf("/apps/%s/certificate", appName), "1.2")
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,209 @@
+// Copyright 2017 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/tsuru/gnuflag"
+	"github.com/tsuru/tsuru/api/types"
+	tsuruapp "github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/cmd"
+)
+
+type AppClone struct {
+	newInstances bool
+	deploy       bool
+	fs           *gnuflag.FlagSet
+}
+
+func (c *AppClone) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-clone",
+		Usage: "app-clone <source-app> <new-app> [--new-instances] [--deploy]",
+		Desc: `Creates a new app based on an existing one.
+
+The new app is created with the same platform, plan, pool, team owner, tags,
+router and router options of the source app. The public environment variables
+of the source app are copied, private variables must be set manually.
+
+The new app is bound to the same service instances of the source app. Use
+[[--new-instances]] to create new service instances, using the same plans,
+instead. The new instances are named after the original ones, suffixed with
+the name of the new app.
+
+Use [[--deploy]] to deploy the image currently running in the source app to
+the new app.`,
+		MinArgs: 2,
+		MaxArgs: 2,
+	}
+}
+
+func (c *AppClone) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("app-clone", gnuflag.ExitOnError)
+		c.fs.BoolVar(&c.newInstances, "new-instances", false, "Create new service instances from the same plans, instead of binding the existing ones")
+		c.fs.BoolVar(&c.deploy, "deploy", false, "Deploy the current image of the source app")
+	}
+	return c.fs
+}
+
+func (c *AppClone) Run(context *cmd.Context, client *cmd.Client) error {
+	context.RawOutput()
+	sourceName, appName := context.Args[0], context.Args[1]
+	source, err := loadApp(client, sourceName)
+	if err != nil {
+		return err
+	}
+	var image string
+	if c.deploy {
+		image, err = currentImage(client, sourceName)
+		if err != nil {
+			return err
+		}
+	}
+	create := AppCreate{
+		teamOwner:  source.TeamOwner,
+		plan:       source.Plan.Name,
+		pool:       source.Pool,
+		router:     source.Router,
+		tags:       cmd.StringSliceFlag(source.Tags),
+		routerOpts: cmd.MapFlag(source.RouterOpts),
+	}
+	createCtx := *context
+	createCtx.Args = []string{appName, source.Platform}
+	if err = create.Run(&createCtx, client); err != nil {
+		return err
+	}
+	if err = c.clone(context, client, source, appName, image); err != nil {
+		return fmt.Errorf("The app %q was created, but cloning %q failed: %s", appName, sourceName, err)
+	}
+	fmt.Fprintf(context.Stdout, "App %q successfully cloned to %q.\n", sourceName, appName)
+	return nil
+}
+
+func (c *AppClone) clone(context *cmd.Context, client *cmd.Client, source *app, appName, image string) error {
+	if err := copyPublicEnvs(context, client, source.Name, appName); err != nil {
+		return err
+	}
+	result, err := getFromURL(fmt.Sprintf("/services/instances?app=%s", source.Name), client)
+	if err != nil {
+		return err
+	}
+	var services []serviceData
+	if len(result) > 0 {
+		if err = json.Unmarshal(result, &services); err != nil {
+			return err
+		}
+	}
+	for _, s := range services {
+		for _, instance := range s.Instances {
+			if c.newInstances {
+				plan, err := instancePlan(client, s, instance)
+				if err != nil {
+					return err
+				}
+				instance = fmt.Sprintf("%s-%s", instance, appName)
+				add := ServiceInstanceAdd{teamOwner: source.TeamOwner}
+				addCtx := *context
+				addCtx.Args = []string{s.Service, instance, plan}
+				if err = add.Run(&addCtx, client); err != nil {
+					return err
+				}
+			}
+			bind := ServiceInstanceBind{}
+			bind.Flags().Parse(true, []string{"-a", appName, "--no-restart"})
+			bindCtx := *context
+			bindCtx.Args = []string{s.Service, instance}
+			if err = bind.Run(&bindCtx, client); err != nil {
+				return err
+			}
+		}
+	}
+	if image == "" {
+		return nil
+	}
+	deploy := AppDeploy{}
+	deploy.Flags().Parse(true, []string{"-a", appName})
+	deploy.image = image
+	deploy.message = fmt.Sprintf("Cloned from %s", source.Name)
+	deployCtx := *context
+	deployCtx.Args = nil
+	return deploy.Run(&deployCtx, client)
+}
+
+// instancePlan returns the plan of the service instance, loaded from the
+// instance itself, as the plans listed along with the instances of an app
+// are not guaranteed to follow their order. It fails when the service has
+// plans but the plan of the instance is unknown.
+func instancePlan(client *cmd.Client, s serviceData, instance string) (string, error) {
+	result, err := getFromURL(fmt.Sprintf("/services/%s/instances/%s", s.Service, instance), client)
+	if err != nil {
+		return "", fmt.Errorf("Unable to find the plan of the instance %q of service %q: %s", instance, s.Service, strings.TrimRight(err.Error(), "\n"))
+	}
+	var info ServiceInstanceInfoModel
+	if err = json.Unmarshal(result, &info); err != nil {
+		return "", err
+	}
+	if info.PlanName == "" {
+		for _, plan := range s.Plans {
+			if plan != "" {
+				return "", fmt.Errorf("Unable to find the plan of the instance %q of service %q.", instance, s.Service)
+			}
+		}
+	}
+	return info.PlanName, nil
+}
+
+// copyPublicEnvs sets the public environment variables of the source app in
+// the target app. Variables reserved by tsuru are not copied.
+func copyPublicEnvs(context *cmd.Context, client *cmd.Client, sourceName, appName string) error {
+	result, err := getFromURL(fmt.Sprintf("/apps/%s/env", sourceName), client)
+	if err != nil {
+		return err
+	}
+	var variables []struct {
+		Name   string
+		Value  string
+		Public bool
+	}
+	if len(result) > 0 {
+		if err = json.Unmarshal(result, &variables); err != nil {
+			return err
+		}
+	}
+	e := types.Envs{NoRestart: true}
+	for _, v := range variables {
+		if v.Public && !strings.HasPrefix(v.Name, "TSURU_") {
+			e.Envs = append(e.Envs, struct{ Name, Value string }{v.Name, v.Value})
+		}
+	}
+	if len(e.Envs) == 0 {
+		return nil
+	}
+	return setEnvs(context, client, appName, &e)
+}
+
+// currentImage returns the image of the last successful deploy of the app.
+func currentImage(client *cmd.Client, appName string) (string, error) {
+	result, err := getFromURL(fmt.Sprintf("/deploys?app=%s&limit=10", appName), client)
+	if err != nil {
+		return "", err
+	}
+	var deploys []tsuruapp.DeployData
+	if len(result) > 0 {
+		if err = json.Unmarshal(result, &deploys); err != nil {
+			return "", err
+		}
+	}
+	for _, d := range deploys {
+		if d.Error == "" && d.Image != "" {
+			return d.Image, nil
+		}
+	}
+	return "", fmt.Errorf("App %q has no successful deploy to clone.", appName)
+}
@@ -0,0 +1,215 @@
+// Copyright 2017 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/tsuru/tsuru/cmd"
+	"gopkg.in/check.v1"
+)
+
+// cloneTransport serves the source app and records every write request,
+// along with its form.
+type cloneTransport struct {
+	deploys   string
+	instances string
+	plans     map[string]string
+	added     []string
+	requests  []string
+	forms     map[string]url.Values
+}
+
+func (t *cloneTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.forms == nil {
+		t.forms = make(map[string]url.Values)
+	}
+	var body string
+	switch {
+	case req.Method == "GET" && req.URL.Path == "/1.0/apps/web":
+		body = `{"name":"web","platform":"python","pool":"prod","teamowner":"team1","router":"hipache","routeropts":{"a":"b"},"tags":["review"],"plan":{"name":"small"}}`
+	case req.Method == "GET" && req.URL.Path == "/1.0/apps/web/env":
+		body = `[{"name":"DEBUG","value":"1","public":true},{"name":"SECRET","value":"s","public":false},{"name":"TSURU_APPNAME","value":"web","public":true}]`
+	case req.Method == "GET" && strings.HasSuffix(req.URL.Path, "/services/instances"):
+		body = t.instances
+		if body == "" {
+			body = `[{"service":"mysql","instances":["db"],"plans":["medium"]}]`
+		}
+	case req.Method == "GET" && strings.HasPrefix(req.URL.Path, "/1.0/services/mysql/instances/"):
+		name := strings.TrimPrefix(req.URL.Path, "/1.0/services/mysql/instances/")
+		plan, ok := t.plans[name]
+		if !ok && t.plans != nil {
+			return &http.Response{
+				Body:       ioutil.NopCloser(strings.NewReader("service instance not found\n")),
+				StatusCode: http.StatusNotFound,
+			}, nil
+		}
+		if !ok {
+			plan = "medium"
+		}
+		body = `{"ServiceName":"mysql","InstanceName":"` + name + `","PlanName":"` + plan + `"}`
+	case req.Method == "GET" && strings.HasSuffix(req.URL.Path, "/deploys"):
+		body = t.deploys
+	case req.Method == "GET":
+		body = `{"name":"review"}`
+	case req.Method == "POST" && strings.HasSuffix(req.URL.Path, "/deploy"):
+		body = "deploy worked\nOK\n"
+	case req.Method == "POST" && req.URL.Path == "/1.0/apps":
+		body = `{"status":"success"}`
+	default:
+		body = `{"message":"ok\n"}` + "\n"
+	}
+	if req.Method != "GET" {
+		req.ParseForm()
+		key := req.Method + " " + req.URL.Path
+		t.requests = append(t.requests, key)
+		t.forms[key] = req.Form
+		if key == "POST /1.0/services/mysql/instances" {
+			t.added = append(t.added, req.Form.Get("name")+" "+req.Form.Get("plan"))
+		}
+	}
+	return &http.Response{
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+		StatusCode: http.StatusOK,
+	}, nil
+}
+
+func (s *S) TestAppCloneInfo(c *check.C) {
+	c.Assert((&AppClone{}).Info(), check.NotNil)
+}
+
+func (s *S) TestAppCloneRun(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"web", "review"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &cloneTransport{}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppClone{}
+	command.Flags().Parse(true, nil)
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(trans.requests, check.DeepEquals, []string{
+		"POST /1.0/apps",
+		"POST /1.0/apps/review/env",
+		"PUT /1.0/services/mysql/instances/db/review",
+	})
+	create := trans.forms["POST /1.0/apps"]
+	c.Assert(create.Get("name"), check.Equals, "review")
+	c.Assert(create.Get("platform"), check.Equals, "python")
+	c.Assert(create.Get("plan"), check.Equals, "small")
+	c.Assert(create.Get("pool"), check.Equals, "prod")
+	c.Assert(create.Get("teamOwner"), check.Equals, "team1")
+	c.Assert(create.Get("router"), check.Equals, "hipache")
+	c.Assert(create["tag"], check.DeepEquals, []string{"review"})
+	c.Assert(create.Get("routeropts.a"), check.Equals, "b")
+	env := trans.forms["POST /1.0/apps/review/env"]
+	c.Assert(env.Get("Envs.0.Name"), check.Equals, "DEBUG")
+	c.Assert(env.Get("Envs.0.Value"), check.Equals, "1")
+	c.Assert(env.Get("Envs.1.Name"), check.Equals, "")
+	c.Assert(env.Get("NoRestart"), check.Equals, "true")
+	c.Assert(trans.forms["PUT /1.0/services/mysql/instances/db/review"].Get("noRestart"), check.Equals, "true")
+	c.Assert(stdout.String(), check.Matches, `(?s)App "review" has been created!.*App "web" successfully cloned to "review".
+`)
+}
+
+func (s *S) TestAppCloneNewInstancesAndDeploy(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"web", "review"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &cloneTransport{
+		deploys: `[{"Image":"registry/web:v3","Error":"failed"},{"Image":"registry/web:v2"}]`,
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppClone{}
+	command.Flags().Parse(true, []string{"--new-instances", "--deploy"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(trans.requests, check.DeepEquals, []string{
+		"POST /1.0/apps",
+		"POST /1.0/apps/review/env",
+		"POST /1.0/services/mysql/instances",
+		"PUT /1.0/services/mysql/instances/db-review/review",
+		"POST /1.0/apps/review/deploy",
+	})
+	add := trans.forms["POST /1.0/services/mysql/instances"]
+	c.Assert(add.Get("name"), check.Equals, "db-review")
+	c.Assert(add.Get("plan"), check.Equals, "medium")
+	c.Assert(add.Get("owner"), check.Equals, "team1")
+	deploy := trans.forms["POST /1.0/apps/review/deploy"]
+	c.Assert(deploy.Get("image"), check.Equals, "registry/web:v2")
+	c.Assert(deploy.Get("message"), check.Equals, "Cloned from web")
+}
+
+func (s *S) TestAppCloneNewInstancesPlanOfEachInstance(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"web", "review"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &cloneTransport{
+		instances: `[{"service":"mysql","instances":["db","cache"],"plans":["large"]}]`,
+		plans:     map[string]string{"db": "medium", "cache": "large"},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppClone{}
+	command.Flags().Parse(true, []string{"--new-instances"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(trans.added, check.DeepEquals, []string{"db-review medium", "cache-review large"})
+	c.Assert(trans.requests, check.DeepEquals, []string{
+		"POST /1.0/apps",
+		"POST /1.0/apps/review/env",
+		"POST /1.0/services/mysql/instances",
+		"PUT /1.0/services/mysql/instances/db-review/review",
+		"POST /1.0/services/mysql/instances",
+		"PUT /1.0/services/mysql/instances/cache-review/review",
+	})
+}
+
+func (s *S) TestAppCloneNewInstancesUnknownPlan(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"web", "review"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &cloneTransport{plans: map[string]string{}}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppClone{}
+	command.Flags().Parse(true, []string{"--new-instances"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.ErrorMatches, `The app "review" was created, but cloning "web" failed: Unable to find the plan of the instance "db" of service "mysql": service instance not found`)
+	c.Assert(trans.requests, check.DeepEquals, []string{
+		"POST /1.0/apps",
+		"POST /1.0/apps/review/env",
+	})
+}
+
+func (s *S) TestAppCloneDeployWithoutImage(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"web", "review"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &cloneTransport{deploys: `[{"Image":"registry/web:v1","Error":"failed"}]`}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppClone{}
+	command.Flags().Parse(true, []string{"--deploy"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.ErrorMatches, `App "web" has no successful deploy to clone.`)
+	c.Assert(trans.requests, check.HasLen, 0)
+}
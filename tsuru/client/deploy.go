@@ -150,6 +150,16 @@ calls are:
     $ tsuru app-deploy myfile.jar Procfile
     $ tsuru app-deploy mysite
     $ tsuru app-deploy -i http://registry.mysite.com:5000/image-name
+
+When called without files or an image, the files or the image defined in the
+deploy section of the project file (` + cmd.ProjectFileName + `) are deployed,
+with the files relative to the directory of the project file:
+
+::
+
+    deploy:
+      files:
+        - .
 `
 	return &cmd.Info{
 		Name:    "app-deploy",
@@ -172,6 +182,20 @@ func (w *safeWriter) Write(p []byte) (int, error) {
 
 func (c *AppDeploy) Run(context *cmd.Context, client *cmd.Client) error {
 	context.RawOutput()
+	// dir is the directory of the deployed files, they're relative to the
+	// working directory unless they come from the project file.
+	var dir string
+	if c.image == "" && len(context.Args) == 0 {
+		project, err := cmd.CurrentProject()
+		if err != nil {
+			return err
+		}
+		if project != nil {
+			c.image = project.Deploy.Image
+			context.Args = project.Deploy.Files
+			dir = project.Dir
+		}
+	}
 	if c.image == "" && len(context.Args) == 0 {
 		return errors.New("You should provide at least one file or a docker image to deploy.\n")
 	}
@@ -235,9 +259,16 @@ func (c *AppDeploy) Run(context *cmd.Context, client *cmd.Client) error {
 			return err
 		}
 		ignoreSet := make(map[string]struct{})
-		ignorePatterns, _ := readTsuruIgnore()
+		ignorePaths := context.Args
+		if dir != "" {
+			ignorePaths = make([]string, len(context.Args))
+			for i, arg := range context.Args {
+				ignorePaths[i] = filepath.Join(dir, arg)
+			}
+		}
+		ignorePatterns, _ := readTsuruIgnore(dir)
 		for _, pattern := range ignorePatterns {
-			ignSet, errProc := processTsuruIgnore(pattern, context.Args...)
+			ignSet, errProc := processTsuruIgnore(pattern, ignorePaths...)
 			if errProc != nil {
 				return errProc
 			}
@@ -245,7 +276,7 @@ func (c *AppDeploy) Run(context *cmd.Context, client *cmd.Client) error {
 				ignoreSet[k] = v
 			}
 		}
-		err = targz(context, file, ignoreSet, context.Args...)
+		err = targzDir(context, file, ignoreSet, dir, context.Args...)
 		if err != nil {
 			return err
 		}
@@ -255,9 +286,13 @@ func (c *AppDeploy) Run(context *cmd.Context, client *cmd.Client) error {
 		megabyte := 1024.0 * 1024.0
 		fmt.Fprintf(context.Stdout, "Uploading files (%0.2fMB)... ", fullSize/megabyte)
 		count := 0
+		done := make(chan struct{})
+		defer close(done)
 		go func() {
 			t0 := time.Now()
 			lastTransferred := 0.0
+			ticker := time.NewTicker(2 * time.Second)
+			defer ticker.Stop()
 			for buf.Len() == 0 {
 				remaining := body.Len()
 				transferred := fullSize - float64(remaining)
@@ -273,7 +308,11 @@ func (c *AppDeploy) Run(context *cmd.Context, client *cmd.Client) error {
 					fmt.Fprintf(safeStdout, " Processing%s", strings.Repeat(".", count))
 					count++
 				}
-				time.Sleep(2e9)
+				select {
+				case <-ticker.C:
+				case <-done:
+					return
+				}
 			}
 		}()
 	}
@@ -350,8 +389,8 @@ func processTsuruIgnore(pattern string, paths ...string) (map[string]struct{}, e
 	return ignoreSet, nil
 }
 
-func readTsuruIgnore() ([]string, error) {
-	file, err := os.Open(".tsuruignore")
+func readTsuruIgnore(dir string) ([]string, error) {
+	file, err := os.Open(filepath.Join(dir, ".tsuruignore"))
 	if err != nil {
 		return nil, err
 	}
@@ -365,6 +404,16 @@ func readTsuruIgnore() ([]string, error) {
 }
 
 func targz(ctx *cmd.Context, destination io.Writer, ignoreSet map[string]struct{}, filepaths ...string) error {
+	return targzDir(ctx, destination, ignoreSet, "", filepaths...)
+}
+
+// targzDir archives the given paths, relative to dir or to the working
+// directory when dir is empty. The names in the archive are relative to dir.
+func targzDir(ctx *cmd.Context, destination io.Writer, ignoreSet map[string]struct{}, dir string, filepaths ...string) error {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
 	var buf bytes.Buffer
 	tarWriter := tar.NewWriter(&buf)
 	for _, path := range filepaths {
@@ -372,31 +421,27 @@ func targz(ctx *cmd.Context, destination io.Writer, ignoreSet map[string]struct{
 			fmt.Fprintf(ctx.Stderr, "Warning: skipping %q", path)
 			continue
 		}
-		fi, err := os.Lstat(path)
-		if err != nil {
-			return err
-		}
-		wd, err := os.Getwd()
+		fi, err := os.Lstat(filepath.Join(dir, path))
 		if err != nil {
 			return err
 		}
-		fiName := filepath.Join(wd, fi.Name())
+		fiName := filepath.Join(root, filepath.Base(path))
 		if _, inSet := ignoreSet[fiName]; inSet {
 			continue
 		}
 		if fi.IsDir() {
 			if len(filepaths) == 1 && path != "." {
-				return singleDir(ctx, destination, path, ignoreSet)
+				return targzDir(ctx, destination, ignoreSet, filepath.Join(dir, path), ".")
 			}
-			err = addDir(tarWriter, path, ignoreSet)
+			err = addDir(tarWriter, dir, path, ignoreSet)
 		} else {
-			err = addFile(tarWriter, path)
+			err = addFile(tarWriter, dir, path)
 		}
 		if err != nil {
 			return err
 		}
 	}
-	err := tarWriter.Close()
+	err = tarWriter.Close()
 	if err != nil {
 		return err
 	}
@@ -406,21 +451,8 @@ func targz(ctx *cmd.Context, destination io.Writer, ignoreSet map[string]struct{
 	return err
 }
 
-func singleDir(ctx *cmd.Context, destination io.Writer, path string, ignoreSet map[string]struct{}) error {
-	old, err := os.Getwd()
-	if err != nil {
-		return err
-	}
-	defer os.Chdir(old)
-	err = os.Chdir(path)
-	if err != nil {
-		return err
-	}
-	return targz(ctx, destination, ignoreSet, ".")
-}
-
-func addDir(writer *tar.Writer, dirpath string, ignoreSet map[string]struct{}) error {
-	dir, err := os.Open(dirpath)
+func addDir(writer *tar.Writer, base, dirpath string, ignoreSet map[string]struct{}) error {
+	dir, err := os.Open(filepath.Join(base, dirpath))
 	if err != nil {
 		return err
 	}
@@ -442,22 +474,22 @@ func addDir(writer *tar.Writer, dirpath string, ignoreSet map[string]struct{}) e
 	if err != nil {
 		return err
 	}
-	wd, err := os.Getwd()
+	root, err := filepath.Abs(base)
 	if err != nil {
 		return err
 	}
 	for _, fi := range fis {
-		fiName := filepath.Join(wd, fi.Name())
+		fiName := filepath.Join(root, fi.Name())
 		if dirpath != "." {
-			fiName = filepath.Join(wd, dirpath, fi.Name())
+			fiName = filepath.Join(root, dirpath, fi.Name())
 		}
 		if _, existSet := ignoreSet[fiName]; existSet {
 			continue
 		}
 		if fi.IsDir() {
-			err = addDir(writer, path.Join(dirpath, fi.Name()), ignoreSet)
+			err = addDir(writer, base, path.Join(dirpath, fi.Name()), ignoreSet)
 		} else {
-			err = addFile(writer, path.Join(dirpath, fi.Name()))
+			err = addFile(writer, base, path.Join(dirpath, fi.Name()))
 		}
 		if err != nil {
 			return err
@@ -466,29 +498,30 @@ func addDir(writer *tar.Writer, dirpath string, ignoreSet map[string]struct{}) e
 	return nil
 }
 
-func addFile(writer *tar.Writer, filepath string) error {
-	f, err := os.Open(filepath)
+func addFile(writer *tar.Writer, base, name string) error {
+	path := filepath.Join(base, name)
+	f, err := os.Open(path)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
-	fi, err := os.Lstat(filepath)
+	fi, err := os.Lstat(path)
 	if err != nil {
 		return err
 	}
 	if fi.Mode()&os.ModeSymlink == os.ModeSymlink {
 		var target string
-		target, err = os.Readlink(filepath)
+		target, err = os.Readlink(path)
 		if err != nil {
 			return err
 		}
-		return addSymlink(writer, filepath, target)
+		return addSymlink(writer, path, name, target)
 	}
 	header, err := tar.FileInfoHeader(fi, "")
 	if err != nil {
 		return err
 	}
-	header.Name = filepath
+	header.Name = name
 	err = writer.WriteHeader(header)
 	if err != nil {
 		return err
@@ -503,7 +536,7 @@ func addFile(writer *tar.Writer, filepath string) error {
 	return nil
 }
 
-func addSymlink(writer *tar.Writer, symlink, target string) error {
+func addSymlink(writer *tar.Writer, symlink, name, target string) error {
 	fi, err := os.Lstat(symlink)
 	if err != nil {
 		return err
@@ -512,7 +545,7 @@ func addSymlink(writer *tar.Writer, symlink, target string) error {
 	if err != nil {
 		return err
 	}
-	header.Name = symlink
+	header.Name = name
 	header.Linkname = target
 	return writer.WriteHeader(header)
 }
@@ -617,7 +650,7 @@ func (c *AppDeployRebuild) Run(context *cmd.Context, client *cmd.Client) error {
 	if err != nil {
 		return err
 	}
-	u, err := cmd.GetURLVersion("1.3", fmt.Sprintf("/apps/%s/deploy/rebuild", appName))
+	u, err := client.URLVersion(fmt.Sprintf("/apps/%s/deploy/rebuild", appName), "1.3")
 	if err != nil {
 		return err
 	}
@@ -71,6 +71,46 @@ func (s *S) TestDeployRun(c *check.C) {
 	c.Assert(calledTimes, check.Equals, 2)
 }
 
+func (s *S) TestDeployRunProjectFiles(c *check.C) {
+	dir, restore := projectDir(c, "app: secret\ndeploy:\n  files:\n    - Procfile\n    - src\n")
+	defer restore()
+	err := ioutil.WriteFile(filepath.Join(dir, "Procfile"), []byte("web: ./run"), 0644)
+	c.Assert(err, check.IsNil)
+	err = ioutil.WriteFile(filepath.Join(dir, "src", "debug.log"), []byte("debug"), 0644)
+	c.Assert(err, check.IsNil)
+	err = ioutil.WriteFile(filepath.Join(dir, ".tsuruignore"), []byte("*.log\n"), 0644)
+	c.Assert(err, check.IsNil)
+	var files []string
+	trans := cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: "deploy worked\nOK\n", Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			if req.Method == "GET" {
+				return strings.HasSuffix(req.URL.Path, "/apps/secret")
+			}
+			file, _, transErr := req.FormFile("file")
+			c.Assert(transErr, check.IsNil)
+			gzipReader, transErr := gzip.NewReader(file)
+			c.Assert(transErr, check.IsNil)
+			tarReader := tar.NewReader(gzipReader)
+			for header, tarErr := tarReader.Next(); tarErr == nil; header, tarErr = tarReader.Next() {
+				files = append(files, header.Name)
+			}
+			return req.Method == "POST" && strings.HasSuffix(req.URL.Path, "/apps/secret/deploy")
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: &trans}, nil, manager)
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	command := AppDeploy{}
+	err = command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	sort.Strings(files)
+	c.Assert(files, check.DeepEquals, []string{"Procfile", "src", "src/pkg"})
+	wd, err := os.Getwd()
+	c.Assert(err, check.IsNil)
+	c.Assert(wd, check.Equals, filepath.Join(dir, "src", "pkg"))
+}
+
 func (s *S) TestDeployImage(c *check.C) {
 	calledTimes := 0
 	trans := cmdtest.ConditionalTransport{
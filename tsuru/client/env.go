@@ -73,48 +73,91 @@ func (c *EnvGet) Run(context *cmd.Context, client *cmd.Client) error {
 
 type EnvSet struct {
 	cmd.GuessingCommand
-	fs        *gnuflag.FlagSet
-	private   bool
-	noRestart bool
+	fs            *gnuflag.FlagSet
+	private       bool
+	noRestart     bool
+	fromEncrypted string
+	keyFile       string
+	selector      appSelector
 }
 
 func (c *EnvSet) Info() *cmd.Info {
 	return &cmd.Info{
-		Name:    "env-set",
-		Usage:   "env-set <NAME=value> [NAME=value] ... [-a/--app appname] [-p/--private] [--no-restart]",
-		Desc:    `Sets environment variables for an application.`,
-		MinArgs: 1,
+		Name:  "env-set",
+		Usage: "env-set <NAME=value> [NAME=value] ... [-a/--app appname] [-p/--private] [--no-restart] [--from-encrypted bundle.enc [--key-file path]] [app filters]",
+		Desc: `Sets environment variables for an application.
+
+When [[--from-encrypted]] is used, all variables stored in the given bundle
+(see [[tsuru env-encrypt]]) are decrypted in memory and set as private
+variables. The plain text values are never written to disk.` + appSelectorHelp,
+		MinArgs: 0,
 	}
 }
 
 func (c *EnvSet) Run(context *cmd.Context, client *cmd.Client) error {
 	context.RawOutput()
-	appName, err := c.Guess()
+	if err := c.selector.checkSingleApp(c.Flags()); err != nil {
+		return err
+	}
+	var appName string
+	if !c.selector.active() {
+		var err error
+		appName, err = c.Guess()
+		if err != nil {
+			return err
+		}
+	}
+	envs, err := c.readEnvs(context)
 	if err != nil {
 		return err
 	}
+	e := types.Envs{
+		Envs:      envs,
+		NoRestart: c.noRestart,
+		Private:   c.private || c.fromEncrypted != "",
+	}
+	if c.selector.active() {
+		return c.selector.run(context, client, "set the variables of", func(ctx *cmd.Context, appName string) error {
+			return setEnvs(ctx, client, appName, &e)
+		})
+	}
+	return setEnvs(context, client, appName, &e)
+}
+
+func (c *EnvSet) readEnvs(context *cmd.Context) ([]struct{ Name, Value string }, error) {
+	if c.fromEncrypted != "" {
+		if len(context.Args) > 0 {
+			return nil, errors.New("You can't specify variables in the command line when using --from-encrypted.")
+		}
+		envs, err := readEnvBundleFile(context, c.fromEncrypted, c.keyFile)
+		if err != nil {
+			return nil, err
+		}
+		if len(envs) == 0 {
+			return nil, errors.New("The encrypted bundle does not contain any variable.")
+		}
+		return envs, nil
+	}
 	if len(context.Args) < 1 {
-		return errors.New(EnvSetValidationMessage)
+		return nil, errors.New(EnvSetValidationMessage)
 	}
 	envs := make([]struct{ Name, Value string }, len(context.Args))
 	for i := range context.Args {
 		parts := strings.SplitN(context.Args[i], "=", 2)
 		if len(parts) != 2 {
-			return errors.New(EnvSetValidationMessage)
+			return nil, errors.New(EnvSetValidationMessage)
 		}
 		envs[i] = struct{ Name, Value string }{Name: parts[0], Value: parts[1]}
-
-	}
-	e := types.Envs{
-		Envs:      envs,
-		NoRestart: c.noRestart,
-		Private:   c.private,
 	}
+	return envs, nil
+}
+
+func setEnvs(context *cmd.Context, client *cmd.Client, appName string, e *types.Envs) error {
 	url, err := cmd.GetURL(fmt.Sprintf("/apps/%s/env", appName))
 	if err != nil {
 		return err
 	}
-	v, err := form.EncodeToValues(&e)
+	v, err := form.EncodeToValues(e)
 	if err != nil {
 		return err
 	}
@@ -146,6 +189,9 @@ func (c *EnvSet) Flags() *gnuflag.FlagSet {
 		c.fs.BoolVar(&c.private, "private", false, "Private environment variables")
 		c.fs.BoolVar(&c.private, "p", false, "Private environment variables")
 		c.fs.BoolVar(&c.noRestart, "no-restart", false, "Sets environment varibles without restart the application")
+		c.fs.StringVar(&c.fromEncrypted, "from-encrypted", "", "Encrypted bundle with the variables to set as private")
+		c.fs.StringVar(&c.keyFile, "key-file", "", "Key file used to decrypt the bundle. When omitted, a passphrase is requested")
+		c.fs = c.selector.flags(c.fs)
 	}
 	return c.fs
 }
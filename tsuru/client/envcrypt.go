@@ -0,0 +1,371 @@
+// Copyright 2017 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/tsuru/gnuflag"
+	"github.com/tsuru/tsuru/cmd"
+)
+
+const (
+	envBundleVersion    = 1
+	envBundleIterations = 100000
+	// envBundleMaxIterations limits the iterations read from bundles, so
+	// a tampered bundle can't hang the command.
+	envBundleMaxIterations = 10000000
+	envBundleKDFKeyFile = "sha256-keyfile"
+	envBundleKDFPass    = "pbkdf2-sha256"
+
+	// envBundlePassphraseEnv is the environment variable that, when set,
+	// is used as the passphrase instead of prompting the user.
+	envBundlePassphraseEnv = "TSURU_ENV_PASSPHRASE"
+)
+
+// envBundle is the on-disk format of an encrypted set of environment
+// variables. Binary fields are base64 encoded by encoding/json, so the
+// bundle is plain text and can be safely committed to git.
+type envBundle struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations,omitempty"`
+	Salt       []byte `json:"salt,omitempty"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+type envBundleEntry struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type EnvEncrypt struct {
+	fs      *gnuflag.FlagSet
+	output  string
+	keyFile string
+}
+
+func (c *EnvEncrypt) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "env-encrypt",
+		Usage: "env-encrypt <envfile|-> [-o/--output bundle.enc] [-k/--key-file path]",
+		Desc: `Encrypts a file containing environment variables in the form "NAME=value"
+(one per line, blank lines and lines starting with # are ignored). Use "-" to
+read the variables from the standard input, in which case the key file or the
+TSURU_ENV_PASSPHRASE environment variable is required.
+
+The resulting bundle can be committed to a repository and later used with
+[[tsuru env-set --from-encrypted]] or [[tsuru env-decrypt]].
+
+The bundle is encrypted with AES-256-GCM, using either the content of the
+given key file or a passphrase. The passphrase is read from the
+TSURU_ENV_PASSPHRASE environment variable, or asked interactively.`,
+		MinArgs: 1,
+		MaxArgs: 1,
+	}
+}
+
+func (c *EnvEncrypt) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("env-encrypt", gnuflag.ExitOnError)
+		output := "File where the encrypted bundle will be written. Defaults to the standard output"
+		c.fs.StringVar(&c.output, "output", "", output)
+		c.fs.StringVar(&c.output, "o", "", output)
+		keyFile := "Key file used to encrypt the bundle. When omitted, a passphrase is requested"
+		c.fs.StringVar(&c.keyFile, "key-file", "", keyFile)
+		c.fs.StringVar(&c.keyFile, "k", "", keyFile)
+	}
+	return c.fs
+}
+
+func (c *EnvEncrypt) Run(context *cmd.Context, client *cmd.Client) error {
+	context.RawOutput()
+	var input io.Reader = context.Stdin
+	if context.Args[0] == "-" {
+		if c.keyFile == "" && os.Getenv(envBundlePassphraseEnv) == "" {
+			return errors.New("The passphrase can't be asked when reading the variables from the standard input, please use --key-file or set " + envBundlePassphraseEnv + ".")
+		}
+	} else {
+		file, err := os.Open(context.Args[0])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		input = file
+	}
+	envs, err := parseEnvFile(input)
+	if err != nil {
+		return err
+	}
+	secret, err := envBundleSecret(context, c.keyFile, true)
+	if err != nil {
+		return err
+	}
+	data, err := encryptEnvBundle(envs, secret, c.keyFile != "")
+	if err != nil {
+		return err
+	}
+	if c.output == "" {
+		_, err = context.Stdout.Write(data)
+		return err
+	}
+	err = ioutil.WriteFile(c.output, data, 0644)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(context.Stdout, "%d variable(s) encrypted to %s.\n", len(envs), c.output)
+	return nil
+}
+
+type EnvDecrypt struct {
+	fs      *gnuflag.FlagSet
+	keyFile string
+}
+
+func (c *EnvDecrypt) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "env-decrypt",
+		Usage: "env-decrypt <bundle.enc> [-k/--key-file path]",
+		Desc: `Decrypts a bundle created by [[tsuru env-encrypt]], printing the variables
+to the standard output in the form "NAME=value".`,
+		MinArgs: 1,
+		MaxArgs: 1,
+	}
+}
+
+func (c *EnvDecrypt) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = gnuflag.NewFlagSet("env-decrypt", gnuflag.ExitOnError)
+		keyFile := "Key file used to decrypt the bundle. When omitted, a passphrase is requested"
+		c.fs.StringVar(&c.keyFile, "key-file", "", keyFile)
+		c.fs.StringVar(&c.keyFile, "k", "", keyFile)
+	}
+	return c.fs
+}
+
+func (c *EnvDecrypt) Run(context *cmd.Context, client *cmd.Client) error {
+	context.RawOutput()
+	envs, err := readEnvBundleFile(context, context.Args[0], c.keyFile)
+	if err != nil {
+		return err
+	}
+	for _, e := range envs {
+		fmt.Fprintf(context.Stdout, "%s=%s\n", e.Name, e.Value)
+	}
+	return nil
+}
+
+// parseEnvFile reads variables in the form NAME=value, one per line.
+func parseEnvFile(r io.Reader) ([]struct{ Name, Value string }, error) {
+	var envs []struct{ Name, Value string }
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		parts := strings.SplitN(text, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid variable in line %d, expected NAME=value", line)
+		}
+		envs = append(envs, struct{ Name, Value string }{Name: parts[0], Value: parts[1]})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return envs, nil
+}
+
+// envBundleSecret returns the secret material used to derive the bundle key,
+// reading it from keyFile or asking for a passphrase.
+func envBundleSecret(context *cmd.Context, keyFile string, confirm bool) ([]byte, error) {
+	if keyFile != "" {
+		key, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, err
+		}
+		key = bytes.TrimSpace(key)
+		if len(key) == 0 {
+			return nil, fmt.Errorf("key file %s is empty", keyFile)
+		}
+		return key, nil
+	}
+	if pass := os.Getenv(envBundlePassphraseEnv); pass != "" {
+		return []byte(pass), nil
+	}
+	if err := context.CheckInteractive("Passphrase", "--key-file or "+envBundlePassphraseEnv); err != nil {
+		return nil, err
+	}
+	fmt.Fprint(context.Stderr, "Passphrase: ")
+	pass, err := cmd.PasswordFromReader(context.Stdin)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(context.Stderr)
+	if confirm {
+		fmt.Fprint(context.Stderr, "Confirm: ")
+		again, err := cmd.PasswordFromReader(context.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintln(context.Stderr)
+		if pass != again {
+			return nil, errors.New("Passphrases didn't match.")
+		}
+	}
+	return []byte(pass), nil
+}
+
+func envBundleKey(bundle *envBundle, secret []byte) ([]byte, error) {
+	switch bundle.KDF {
+	case envBundleKDFKeyFile:
+		key := sha256.Sum256(secret)
+		return key[:], nil
+	case envBundleKDFPass:
+		if bundle.Iterations < envBundleIterations || bundle.Iterations > envBundleMaxIterations {
+			return nil, fmt.Errorf("invalid encrypted bundle: %d iterations, expected between %d and %d", bundle.Iterations, envBundleIterations, envBundleMaxIterations)
+		}
+		return pbkdf2Key(secret, bundle.Salt, bundle.Iterations, 32), nil
+	}
+	return nil, fmt.Errorf("unsupported key derivation %q in bundle", bundle.KDF)
+}
+
+func encryptEnvBundle(envs []struct{ Name, Value string }, secret []byte, withKeyFile bool) ([]byte, error) {
+	entries := make([]envBundleEntry, len(envs))
+	for i, e := range envs {
+		entries[i] = envBundleEntry{Name: e.Name, Value: e.Value}
+	}
+	plain, err := json.Marshal(entries)
+	if err != nil {
+		return nil, err
+	}
+	bundle := envBundle{Version: envBundleVersion, KDF: envBundleKDFKeyFile}
+	if !withKeyFile {
+		bundle.KDF = envBundleKDFPass
+		bundle.Iterations = envBundleIterations
+		bundle.Salt = make([]byte, 16)
+		if _, err = rand.Read(bundle.Salt); err != nil {
+			return nil, err
+		}
+	}
+	key, err := envBundleKey(&bundle, secret)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	bundle.Nonce = make([]byte, gcm.NonceSize())
+	if _, err = rand.Read(bundle.Nonce); err != nil {
+		return nil, err
+	}
+	bundle.Data = gcm.Seal(nil, bundle.Nonce, plain, nil)
+	data, err := json.MarshalIndent(bundle, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+func decryptEnvBundle(data, secret []byte) ([]struct{ Name, Value string }, error) {
+	var bundle envBundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("invalid encrypted bundle: %s", err)
+	}
+	if bundle.Version != envBundleVersion {
+		return nil, fmt.Errorf("unsupported bundle version %d", bundle.Version)
+	}
+	key, err := envBundleKey(&bundle, secret)
+	if err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(bundle.Nonce) != gcm.NonceSize() {
+		return nil, errors.New("invalid encrypted bundle: bad nonce size")
+	}
+	plain, err := gcm.Open(nil, bundle.Nonce, bundle.Data, nil)
+	if err != nil {
+		return nil, errors.New("unable to decrypt bundle: wrong key or passphrase, or corrupted bundle")
+	}
+	var entries []envBundleEntry
+	if err = json.Unmarshal(plain, &entries); err != nil {
+		return nil, err
+	}
+	envs := make([]struct{ Name, Value string }, len(entries))
+	for i, e := range entries {
+		envs[i] = struct{ Name, Value string }{Name: e.Name, Value: e.Value}
+	}
+	return envs, nil
+}
+
+func readEnvBundleFile(context *cmd.Context, path, keyFile string) ([]struct{ Name, Value string }, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := envBundleSecret(context, keyFile, false)
+	if err != nil {
+		return nil, err
+	}
+	return decryptEnvBundle(data, secret)
+}
+
+// newGCM returns an AES-GCM cipher using the given key, which must have 16, 24
+// or 32 bytes.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// pbkdf2Key derives a key from the password using PBKDF2 with HMAC-SHA256, as
+// defined in RFC 8018.
+func pbkdf2Key(password, salt []byte, iterations, keyLen int) []byte {
+	prf := hmac.New(sha256.New, password)
+	hashLen := prf.Size()
+	numBlocks := (keyLen + hashLen - 1) / hashLen
+	var counter [4]byte
+	dk := make([]byte, 0, numBlocks*hashLen)
+	u := make([]byte, hashLen)
+	for block := 1; block <= numBlocks; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		binary.BigEndian.PutUint32(counter[:], uint32(block))
+		prf.Write(counter[:])
+		dk = prf.Sum(dk)
+		t := dk[len(dk)-hashLen:]
+		copy(u, t)
+		for n := 2; n <= iterations; n++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for i := range u {
+				t[i] ^= u[i]
+			}
+		}
+	}
+	return dk[:keyLen]
+}
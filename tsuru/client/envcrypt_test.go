@@ -0,0 +1,247 @@
+// Copyright 2017 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ajg/form"
+	"github.com/tsuru/tsuru/api/types"
+	"github.com/tsuru/tsuru/cmd"
+	"github.com/tsuru/tsuru/cmd/cmdtest"
+	"github.com/tsuru/tsuru/io"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestEnvEncryptInfo(c *check.C) {
+	c.Assert((&EnvEncrypt{}).Info(), check.NotNil)
+}
+
+func (s *S) TestEnvDecryptInfo(c *check.C) {
+	c.Assert((&EnvDecrypt{}).Info(), check.NotNil)
+}
+
+func (s *S) TestParseEnvFile(c *check.C) {
+	input := "# database\nDATABASE_HOST=somehost\n\n  DATABASE_URL=mysql://u:p@h/db?a=b  \n"
+	envs, err := parseEnvFile(strings.NewReader(input))
+	c.Assert(err, check.IsNil)
+	c.Assert(envs, check.DeepEquals, []struct{ Name, Value string }{
+		{Name: "DATABASE_HOST", Value: "somehost"},
+		{Name: "DATABASE_URL", Value: "mysql://u:p@h/db?a=b"},
+	})
+}
+
+func (s *S) TestParseEnvFileInvalidLine(c *check.C) {
+	_, err := parseEnvFile(strings.NewReader("A=1\nINVALID\n"))
+	c.Assert(err, check.ErrorMatches, "invalid variable in line 2, expected NAME=value")
+}
+
+func (s *S) TestEncryptDecryptEnvBundleWithKeyFile(c *check.C) {
+	envs := []struct{ Name, Value string }{{Name: "SECRET", Value: "s3cr3t"}}
+	data, err := encryptEnvBundle(envs, []byte("my key"), true)
+	c.Assert(err, check.IsNil)
+	c.Assert(strings.Contains(string(data), "s3cr3t"), check.Equals, false)
+	var bundle envBundle
+	err = json.Unmarshal(data, &bundle)
+	c.Assert(err, check.IsNil)
+	c.Assert(bundle.KDF, check.Equals, envBundleKDFKeyFile)
+	decrypted, err := decryptEnvBundle(data, []byte("my key"))
+	c.Assert(err, check.IsNil)
+	c.Assert(decrypted, check.DeepEquals, envs)
+	_, err = decryptEnvBundle(data, []byte("other key"))
+	c.Assert(err, check.ErrorMatches, "unable to decrypt bundle: .*")
+}
+
+func (s *S) TestEncryptDecryptEnvBundleWithPassphrase(c *check.C) {
+	envs := []struct{ Name, Value string }{{Name: "SECRET", Value: "s3cr3t"}, {Name: "OTHER", Value: "a=b"}}
+	data, err := encryptEnvBundle(envs, []byte("pass"), false)
+	c.Assert(err, check.IsNil)
+	var bundle envBundle
+	err = json.Unmarshal(data, &bundle)
+	c.Assert(err, check.IsNil)
+	c.Assert(bundle.KDF, check.Equals, envBundleKDFPass)
+	c.Assert(bundle.Iterations, check.Equals, envBundleIterations)
+	c.Assert(bundle.Salt, check.HasLen, 16)
+	decrypted, err := decryptEnvBundle(data, []byte("pass"))
+	c.Assert(err, check.IsNil)
+	c.Assert(decrypted, check.DeepEquals, envs)
+	_, err = decryptEnvBundle(data, []byte("wrong"))
+	c.Assert(err, check.NotNil)
+}
+
+func (s *S) TestEnvEncryptAndDecryptRun(c *check.C) {
+	dir := c.MkDir()
+	keyFile := filepath.Join(dir, "key")
+	err := ioutil.WriteFile(keyFile, []byte("supersecretkey"), 0600)
+	c.Assert(err, check.IsNil)
+	bundlePath := filepath.Join(dir, "bundle.enc")
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"-"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Stdin:  strings.NewReader("DATABASE_HOST=somehost\nDATABASE_PASSWORD=123\n"),
+	}
+	command := EnvEncrypt{}
+	command.Flags().Parse(true, []string{"-k", keyFile, "-o", bundlePath})
+	err = command.Run(&context, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "2 variable(s) encrypted to "+bundlePath+".\n")
+	stdout.Reset()
+	context.Args = []string{bundlePath}
+	decrypt := EnvDecrypt{}
+	decrypt.Flags().Parse(true, []string{"--key-file", keyFile})
+	err = decrypt.Run(&context, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "DATABASE_HOST=somehost\nDATABASE_PASSWORD=123\n")
+}
+
+func (s *S) TestEnvEncryptRunStdinWithoutKey(c *check.C) {
+	os.Unsetenv(envBundlePassphraseEnv)
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"-"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Stdin:  strings.NewReader("A=1\n"),
+	}
+	err := (&EnvEncrypt{}).Run(&context, nil)
+	c.Assert(err, check.ErrorMatches, "The passphrase can't be asked when reading the variables from the standard input, .*TSURU_ENV_PASSPHRASE.")
+	c.Assert(stdout.String(), check.Equals, "")
+	c.Assert(stderr.String(), check.Equals, "")
+}
+
+func (s *S) TestEnvEncryptRunStdinPassphraseFromEnvironment(c *check.C) {
+	os.Setenv(envBundlePassphraseEnv, "pass")
+	defer os.Unsetenv(envBundlePassphraseEnv)
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"-"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Stdin:  strings.NewReader("A=1\n"),
+	}
+	err := (&EnvEncrypt{}).Run(&context, nil)
+	c.Assert(err, check.IsNil)
+	envs, err := decryptEnvBundle(stdout.Bytes(), []byte("pass"))
+	c.Assert(err, check.IsNil)
+	c.Assert(envs, check.DeepEquals, []struct{ Name, Value string }{{Name: "A", Value: "1"}})
+}
+
+func (s *S) TestPBKDF2Key(c *check.C) {
+	// PBKDF2-HMAC-SHA256 test vector from RFC 7914, section 11.
+	key := pbkdf2Key([]byte("passwd"), []byte("salt"), 1, 32)
+	c.Assert(hex.EncodeToString(key), check.Equals, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc")
+}
+
+func (s *S) TestEnvBundlePassphraseKeyIterations(c *check.C) {
+	bundle := envBundle{KDF: envBundleKDFPass, Salt: []byte("salt"), Iterations: envBundleIterations}
+	key, err := envBundleKey(&bundle, []byte("passwd"))
+	c.Assert(err, check.IsNil)
+	c.Assert(key, check.DeepEquals, pbkdf2Key([]byte("passwd"), []byte("salt"), envBundleIterations, 32))
+	for _, iterations := range []int{-1, 0, 1, envBundleIterations - 1, envBundleMaxIterations + 1} {
+		bundle.Iterations = iterations
+		_, err = envBundleKey(&bundle, []byte("passwd"))
+		c.Check(err, check.ErrorMatches, `invalid encrypted bundle: -?\d+ iterations, expected between 100000 and 10000000`, check.Commentf("%d", iterations))
+	}
+}
+
+func (s *S) TestEnvBundleSecretKeyFileTrimmed(c *check.C) {
+	dir := c.MkDir()
+	keyFile := filepath.Join(dir, "key")
+	err := ioutil.WriteFile(keyFile, []byte("supersecretkey"), 0600)
+	c.Assert(err, check.IsNil)
+	keyFileNewline := filepath.Join(dir, "key-newline")
+	err = ioutil.WriteFile(keyFileNewline, []byte("supersecretkey\n"), 0600)
+	c.Assert(err, check.IsNil)
+	context := cmd.Context{}
+	secret, err := envBundleSecret(&context, keyFile, false)
+	c.Assert(err, check.IsNil)
+	secretNewline, err := envBundleSecret(&context, keyFileNewline, false)
+	c.Assert(err, check.IsNil)
+	c.Assert(secretNewline, check.DeepEquals, secret)
+}
+
+func (s *S) TestEnvDecryptRunPassphraseFromEnvironment(c *check.C) {
+	os.Setenv(envBundlePassphraseEnv, "pass")
+	defer os.Unsetenv(envBundlePassphraseEnv)
+	data, err := encryptEnvBundle([]struct{ Name, Value string }{{Name: "A", Value: "1"}}, []byte("pass"), false)
+	c.Assert(err, check.IsNil)
+	bundlePath := filepath.Join(c.MkDir(), "bundle.enc")
+	err = ioutil.WriteFile(bundlePath, data, 0644)
+	c.Assert(err, check.IsNil)
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{bundlePath},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	err = (&EnvDecrypt{}).Run(&context, nil)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, "A=1\n")
+}
+
+func (s *S) TestEnvSetRunFromEncrypted(c *check.C) {
+	dir := c.MkDir()
+	keyFile := filepath.Join(dir, "key")
+	err := ioutil.WriteFile(keyFile, []byte("supersecretkey"), 0600)
+	c.Assert(err, check.IsNil)
+	envs := []struct{ Name, Value string }{{Name: "DATABASE_HOST", Value: "somehost"}, {Name: "DATABASE_USER", Value: "root"}}
+	data, err := encryptEnvBundle(envs, []byte("supersecretkey"), true)
+	c.Assert(err, check.IsNil)
+	bundlePath := filepath.Join(dir, "bundle.enc")
+	err = ioutil.WriteFile(bundlePath, data, 0644)
+	c.Assert(err, check.IsNil)
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	expectedOut := "variable(s) successfully exported\n"
+	msg := io.SimpleJsonMessage{Message: expectedOut}
+	result, err := json.Marshal(msg)
+	c.Assert(err, check.IsNil)
+	trans := &cmdtest.ConditionalTransport{
+		Transport: cmdtest.Transport{Message: string(result), Status: http.StatusOK},
+		CondFunc: func(req *http.Request) bool {
+			err = req.ParseForm()
+			c.Assert(err, check.IsNil)
+			var e types.Envs
+			dec := form.NewDecoder(nil)
+			dec.IgnoreUnknownKeys(true)
+			err = dec.DecodeValues(&e, req.Form)
+			c.Assert(err, check.IsNil)
+			c.Assert(e.Envs, check.DeepEquals, envs)
+			c.Assert(e.Private, check.Equals, true)
+			return strings.HasSuffix(req.URL.Path, "/apps/someapp/env") && req.Method == "POST"
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := EnvSet{}
+	command.Flags().Parse(true, []string{"-a", "someapp", "--from-encrypted", bundlePath, "--key-file", keyFile})
+	err = command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Equals, expectedOut)
+}
+
+func (s *S) TestEnvSetRunFromEncryptedWithArgs(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Args:   []string{"A=1"},
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	command := EnvSet{}
+	command.Flags().Parse(true, []string{"-a", "someapp", "--from-encrypted", "bundle.enc"})
+	err := command.Run(&context, nil)
+	c.Assert(err, check.ErrorMatches, "You can't specify variables in the command line when using --from-encrypted.")
+}
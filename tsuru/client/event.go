@@ -90,7 +90,7 @@ func (c *EventList) Run(context *cmd.Context, client *cmd.Client) error {
 	if err != nil {
 		return err
 	}
-	u, err := cmd.GetURLVersion("1.1", fmt.Sprintf("/events?%s", qs.Encode()))
+	u, err := client.URLVersion(fmt.Sprintf("/events?%s", qs.Encode()), "1.1")
 	if err != nil {
 		return err
 	}
@@ -177,7 +177,7 @@ func (c *EventInfo) Info() *cmd.Info {
 }
 
 func (c *EventInfo) Run(context *cmd.Context, client *cmd.Client) error {
-	u, err := cmd.GetURLVersion("1.1", fmt.Sprintf("/events/%s", context.Args[0]))
+	u, err := client.URLVersion(fmt.Sprintf("/events/%s", context.Args[0]), "1.1")
 	if err != nil {
 		return err
 	}
@@ -305,7 +305,7 @@ func (c *EventCancel) Run(context *cmd.Context, client *cmd.Client) error {
 	if !c.Confirm(context, "Are you sure you want to cancel this event?") {
 		return nil
 	}
-	u, err := cmd.GetURLVersion("1.1", fmt.Sprintf("/events/%s/cancel", context.Args[0]))
+	u, err := client.URLVersion(fmt.Sprintf("/events/%s/cancel", context.Args[0]), "1.1")
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,74 @@
+// Copyright 2017 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/tsuru/tsuru/cmd"
+	"github.com/tsuru/tsuru/errors"
+)
+
+// fetchErrors aggregates the errors of the functions run by fetchAll.
+type fetchErrors []error
+
+func (e fetchErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// fetchAll runs the given functions, usually requests to the API independent
+// of each other, concurrently and waits for all of them to finish. When the
+// client is verbose, the functions run sequentially, so the dumps of the
+// requests are not mixed.
+//
+// If any function fails with an unauthorized error, that error is returned,
+// allowing the login flow of the manager to take place. Otherwise, the errors
+// with distinct messages are returned together, in the order of the
+// functions, or alone when there's only one of them.
+func fetchAll(client *cmd.Client, fns ...func() error) error {
+	errs := make([]error, len(fns))
+	if client.Verbosity > 0 {
+		for i, fn := range fns {
+			errs[i] = fn()
+		}
+	} else {
+		var wg sync.WaitGroup
+		for i, fn := range fns {
+			wg.Add(1)
+			go func(i int, fn func() error) {
+				defer wg.Done()
+				errs[i] = fn()
+			}(i, fn)
+		}
+		wg.Wait()
+	}
+	var result fetchErrors
+	seen := make(map[string]bool)
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		if e, ok := err.(*errors.HTTP); ok && e.Code == http.StatusUnauthorized {
+			return err
+		}
+		if !seen[err.Error()] {
+			seen[err.Error()] = true
+			result = append(result, err)
+		}
+	}
+	switch len(result) {
+	case 0:
+		return nil
+	case 1:
+		return result[0]
+	}
+	return result
+}
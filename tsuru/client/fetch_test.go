@@ -0,0 +1,92 @@
+// Copyright 2017 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/tsuru/tsuru/cmd"
+	"github.com/tsuru/tsuru/cmd/cmdtest"
+	tsuruErrors "github.com/tsuru/tsuru/errors"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestFetchAllRunsConcurrently(c *check.C) {
+	client := cmd.NewClient(&http.Client{}, nil, manager)
+	var wg sync.WaitGroup
+	wg.Add(2)
+	fn := func() error {
+		wg.Done()
+		wg.Wait()
+		return nil
+	}
+	done := make(chan error)
+	go func() {
+		done <- fetchAll(client, fn, fn)
+	}()
+	select {
+	case err := <-done:
+		c.Assert(err, check.IsNil)
+	case <-time.After(5 * time.Second):
+		c.Fatal("functions were not run concurrently")
+	}
+}
+
+func (s *S) TestFetchAllVerboseRunsSequentially(c *check.C) {
+	client := cmd.NewClient(&http.Client{}, &cmd.Context{Stdout: &bytes.Buffer{}}, manager)
+	client.Verbosity = 1
+	var order []int
+	err := fetchAll(client,
+		func() error { order = append(order, 1); return nil },
+		func() error { order = append(order, 2); return nil },
+	)
+	c.Assert(err, check.IsNil)
+	c.Assert(order, check.DeepEquals, []int{1, 2})
+}
+
+func (s *S) TestFetchAllErrors(c *check.C) {
+	client := cmd.NewClient(&http.Client{}, nil, manager)
+	errA, errB := errors.New("a failed"), errors.New("b failed")
+	ok := func() error { return nil }
+	fail := func(err error) func() error {
+		return func() error { return err }
+	}
+	err := fetchAll(client, ok, fail(errA), ok)
+	c.Assert(err, check.Equals, errA)
+	err = fetchAll(client, fail(errA), fail(errors.New("a failed")))
+	c.Assert(err, check.Equals, errA)
+	err = fetchAll(client, fail(errB), ok, fail(errA))
+	c.Assert(err, check.ErrorMatches, "b failed\na failed")
+	unauthorized := &tsuruErrors.HTTP{Code: http.StatusUnauthorized, Message: "unauthorized"}
+	err = fetchAll(client, fail(errA), fail(unauthorized))
+	c.Assert(err, check.Equals, unauthorized)
+}
+
+func (s *S) TestTagListAggregatesErrors(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &cmdtest.AnyConditionalTransport{
+		ConditionalTransports: []cmdtest.ConditionalTransport{
+			{
+				Transport: cmdtest.Transport{Message: "apps failed", Status: http.StatusInternalServerError},
+				CondFunc:  func(req *http.Request) bool { return req.URL.Path == "/1.0/apps" },
+			},
+			{
+				Transport: cmdtest.Transport{Message: "services failed", Status: http.StatusInternalServerError},
+				CondFunc:  func(req *http.Request) bool { return req.URL.Path == "/1.0/services" },
+			},
+		},
+	}
+	command := TagList{}
+	err := command.Run(&context, cmd.NewClient(&http.Client{Transport: trans}, nil, manager))
+	c.Assert(err, check.ErrorMatches, "apps failed\nservices failed")
+}
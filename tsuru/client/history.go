@@ -0,0 +1,276 @@
+// Copyright 2017 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/tsuru/gnuflag"
+	tsuruapp "github.com/tsuru/tsuru/app"
+	"github.com/tsuru/tsuru/cmd"
+	"github.com/tsuru/tsuru/event"
+)
+
+// historyNow returns the current time, used as the reference for --since.
+var historyNow = time.Now
+
+type historyEntry struct {
+	Time     time.Time     `json:"time"`
+	Duration time.Duration `json:"duration"`
+	Running  bool          `json:"running"`
+	Source   string        `json:"source"`
+	Kind     string        `json:"kind"`
+	Owner    string        `json:"owner"`
+	Details  string        `json:"details,omitempty"`
+	Error    string        `json:"error,omitempty"`
+	// id identifies the event of the entry, which deploy records share with
+	// the events of their deploys.
+	id string
+}
+
+type historyByTime []historyEntry
+
+func (l historyByTime) Len() int           { return len(l) }
+func (l historyByTime) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
+func (l historyByTime) Less(i, j int) bool { return l[i].Time.Before(l[j].Time) }
+
+type AppHistory struct {
+	cmd.GuessingCommand
+	since time.Duration
+	limit int
+	json  bool
+	fs    *gnuflag.FlagSet
+}
+
+func (c *AppHistory) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-history",
+		Usage: "app-history [-a/--app appname] [--since 24h] [--limit 100] [--json]",
+		Desc: `Shows a timeline of what happened to an application.
+
+The timeline merges the events targeting the app (see [[tsuru event-list]]),
+the deploys of the app (see [[tsuru app-deploy-list]]) and the current lock
+of the app, in chronological order. Each deploy is shown once, although it's
+also an event. Only entries started in the period given by [[--since]] are
+shown, among the last [[--limit]] deploys.
+
+Use [[--json]] to show the timeline as JSON.`,
+		MinArgs: 0,
+	}
+}
+
+func (c *AppHistory) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = c.GuessingCommand.Flags()
+		c.fs.DurationVar(&c.since, "since", 24*time.Hour, "Show entries started in the given period")
+		c.fs.IntVar(&c.limit, "limit", 100, "Maximum number of deploys fetched")
+		c.fs.BoolVar(&c.json, "json", false, "Show the timeline as JSON")
+	}
+	return c.fs
+}
+
+func (c *AppHistory) Run(context *cmd.Context, client *cmd.Client) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	if c.since <= 0 {
+		return errors.New("The period given by --since must be greater than zero.")
+	}
+	if c.limit <= 0 {
+		return errors.New("The limit given by --limit must be greater than zero.")
+	}
+	since := historyNow().Add(-c.since)
+	var a *app
+	var entries, deploys []historyEntry
+	err = fetchAll(client,
+		func() error {
+			var err error
+			a, err = loadApp(client, appName)
+			return err
+		},
+		func() error {
+			var err error
+			entries, err = appEvents(client, appName, since)
+			return err
+		},
+		func() error {
+			var err error
+			deploys, err = appDeploys(client, appName, since, c.limit)
+			return err
+		},
+	)
+	if err != nil {
+		return err
+	}
+	entries = append(withoutDeployEvents(entries, deploys), deploys...)
+	if a.Lock.Locked {
+		entries = append(entries, historyEntry{
+			Time:     a.Lock.AcquireDate,
+			Duration: historyNow().Sub(a.Lock.AcquireDate),
+			Running:  true,
+			Source:   "lock",
+			Kind:     "lock",
+			Owner:    a.Lock.Owner,
+			Details:  a.Lock.Reason,
+		})
+	}
+	sort.Stable(historyByTime(entries))
+	if c.json {
+		return json.NewEncoder(context.Stdout).Encode(entries)
+	}
+	if len(entries) == 0 {
+		fmt.Fprintf(context.Stdout, "No history for app %q in the last %s.\n", appName, c.since)
+		return nil
+	}
+	renderHistory(context, entries)
+	return nil
+}
+
+func appEvents(client *cmd.Client, appName string, since time.Time) ([]historyEntry, error) {
+	f := eventFilter{filter: event.Filter{
+		Target: event.Target{Type: event.TargetTypeApp, Value: appName},
+		Since:  since,
+	}}
+	qs, err := f.queryString(client)
+	if err != nil {
+		return nil, err
+	}
+	u, err := client.URLVersion(fmt.Sprintf("/events?%s", qs.Encode()), "1.1")
+	if err != nil {
+		return nil, err
+	}
+	request, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	result, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	var evts []event.Event
+	if len(result) > 0 {
+		if err = json.Unmarshal(result, &evts); err != nil {
+			return nil, fmt.Errorf("unable to unmarshal %q: %s", string(result), err)
+		}
+	}
+	entries := make([]historyEntry, 0, len(evts))
+	for i := range evts {
+		evt := &evts[i]
+		if evt.StartTime.Before(since) {
+			continue
+		}
+		entry := historyEntry{
+			Time:    evt.StartTime,
+			Running: evt.Running,
+			Source:  "event",
+			Kind:    evt.Kind.Name,
+			Owner:   evt.Owner.Name,
+			Details: evt.UniqueID.Hex(),
+			Error:   evt.Error,
+			id:      evt.UniqueID.Hex(),
+		}
+		if evt.Running {
+			entry.Duration = historyNow().Sub(evt.StartTime)
+		} else {
+			entry.Duration = evt.EndTime.Sub(evt.StartTime)
+		}
+		if evt.CancelInfo.Canceled {
+			entry.Details += " (canceled)"
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func appDeploys(client *cmd.Client, appName string, since time.Time, limit int) ([]historyEntry, error) {
+	result, err := getFromURL(fmt.Sprintf("/deploys?app=%s&limit=%d", appName, limit), client)
+	if err != nil {
+		return nil, err
+	}
+	var deploys []tsuruapp.DeployData
+	if len(result) > 0 {
+		if err = json.Unmarshal(result, &deploys); err != nil {
+			return nil, err
+		}
+	}
+	entries := make([]historyEntry, 0, len(deploys))
+	for _, d := range deploys {
+		if d.Timestamp.Before(since) {
+			continue
+		}
+		entries = append(entries, historyEntry{
+			Time:     d.Timestamp,
+			Duration: d.Duration,
+			Source:   "deploy",
+			Kind:     d.Origin,
+			Owner:    d.User,
+			Details:  d.Image,
+			Error:    d.Error,
+			id:       d.ID.Hex(),
+		})
+	}
+	return entries, nil
+}
+
+// withoutDeployEvents returns the events that aren't the event of one of the
+// deploys, which are shown by the deploy records instead.
+func withoutDeployEvents(events, deploys []historyEntry) []historyEntry {
+	ids := make(map[string]bool, len(deploys))
+	for _, d := range deploys {
+		if d.id != "" {
+			ids[d.id] = true
+		}
+	}
+	result := make([]historyEntry, 0, len(events))
+	for _, e := range events {
+		if !ids[e.id] {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+func renderHistory(context *cmd.Context, entries []historyEntry) {
+	tbl := cmd.NewTable()
+	tbl.Headers = cmd.Row{"Start (duration)", "Source", "Kind", "Owner", "Details", "Error"}
+	for _, e := range entries {
+		startFmt := e.Time.Format(time.RFC822Z)
+		ts := fmt.Sprintf("%s (%v)", startFmt, e.Duration)
+		if e.Running {
+			ts = fmt.Sprintf("%s (…)", startFmt)
+		}
+		owner := reEmailShort.ReplaceAllString(e.Owner, "@…")
+		errorLine := strings.SplitN(strings.TrimSpace(e.Error), "\n", 2)[0]
+		row := cmd.Row{ts, e.Source, e.Kind, owner, e.Details, errorLine}
+		var color string
+		if e.Running {
+			color = "yellow"
+		} else if e.Error != "" {
+			color = "red"
+		}
+		if color != "" {
+			for i, v := range row {
+				if v != "" {
+					row[i] = cmd.Colorfy(v, color, "", "")
+				}
+			}
+		}
+		tbl.AddRow(row)
+	}
+	fmt.Fprintf(context.Stdout, "%s", tbl.String())
+}
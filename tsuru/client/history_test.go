@@ -0,0 +1,145 @@
+// Copyright 2017 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/cmd"
+	"github.com/tsuru/tsuru/cmd/cmdtest"
+	"gopkg.in/check.v1"
+)
+
+func historyTransport(c *check.C, limit string) *cmdtest.AnyConditionalTransport {
+	appData := `{"name":"myapp","lock":{"Locked":true,"Owner":"admin@example.com","Reason":"POST /apps/myapp/restart","AcquireDate":"2016-07-19T11:59:00-03:00"}}`
+	evts := `[
+{"UniqueID":"578e3908413daf5fd9891aac","StartTime":"2016-07-19T11:28:00-03:00","EndTime":"2016-07-19T11:28:57-03:00","Kind":{"Type":"permission","Name":"app.deploy"},"Owner":{"Type":"user","Name":"someone@example.com"}},
+{"UniqueID":"5787bcc8413daf2aeb040730","StartTime":"2016-07-19T10:00:00-03:00","EndTime":"2016-07-19T10:00:10-03:00","Kind":{"Type":"permission","Name":"app.update.env.set"},"Owner":{"Type":"user","Name":"other@example.com"},"Error":"env failed\nmore details"},
+{"UniqueID":"5787bcc8413daf2aeb040731","StartTime":"2016-07-17T10:00:00-03:00","EndTime":"2016-07-17T10:00:10-03:00","Kind":{"Type":"permission","Name":"app.update"},"Owner":{"Type":"user","Name":"other@example.com"}}
+]`
+	deploys := `[
+{"ID":"578e3908413daf5fd9891aac","Timestamp":"2016-07-19T11:28:05-03:00","Duration":50000000000,"Origin":"git","User":"someone@example.com","Image":"tsuru/app-myapp:v2"},
+{"Timestamp":"2016-07-18T08:00:00-03:00","Duration":60000000000,"Origin":"app-deploy","User":"someone@example.com","Image":"tsuru/app-myapp:v1"}
+]`
+	return &cmdtest.AnyConditionalTransport{
+		ConditionalTransports: []cmdtest.ConditionalTransport{
+			{
+				Transport: cmdtest.Transport{Message: appData, Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					return req.URL.Path == "/1.0/apps/myapp"
+				},
+			},
+			{
+				Transport: cmdtest.Transport{Message: evts, Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					if req.URL.Path != "/1.1/events" {
+						return false
+					}
+					c.Assert(req.URL.Query().Get("target.type"), check.Equals, "app")
+					c.Assert(req.URL.Query().Get("target.value"), check.Equals, "myapp")
+					c.Assert(req.URL.Query().Get("since"), check.Not(check.Equals), "")
+					return true
+				},
+			},
+			{
+				Transport: cmdtest.Transport{Message: deploys, Status: http.StatusOK},
+				CondFunc: func(req *http.Request) bool {
+					return req.URL.Path == "/1.0/deploys" && req.URL.Query().Get("app") == "myapp" && req.URL.Query().Get("limit") == limit
+				},
+			},
+		},
+	}
+}
+
+func fakeHistoryNow() time.Time {
+	now, _ := time.Parse(time.RFC3339, "2016-07-19T12:00:00-03:00")
+	return now
+}
+
+func (s *S) TestAppHistoryInfo(c *check.C) {
+	c.Assert((&AppHistory{}).Info(), check.NotNil)
+}
+
+func (s *S) TestAppHistory(c *check.C) {
+	os.Setenv("TSURU_DISABLE_COLORS", "1")
+	defer os.Unsetenv("TSURU_DISABLE_COLORS")
+	defer func(f func() time.Time) { historyNow = f }(historyNow)
+	historyNow = fakeHistoryNow
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: historyTransport(c, "100")}, nil, manager)
+	command := AppHistory{}
+	command.Flags().Parse(true, []string{"-a", "myapp"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	expected := `+-----------------------------+--------+--------------------+-----------+--------------------------+------------+
+| Start (duration)            | Source | Kind               | Owner     | Details                  | Error      |
++-----------------------------+--------+--------------------+-----------+--------------------------+------------+
+| 19 Jul 16 10:00 -0300 (10s) | event  | app.update.env.set | other@…   | 5787bcc8413daf2aeb040730 | env failed |
+| 19 Jul 16 11:28 -0300 (50s) | deploy | git                | someone@… | tsuru/app-myapp:v2       |            |
+| 19 Jul 16 11:59 -0300 (…)   | lock   | lock               | admin@…   | POST /apps/myapp/restart |            |
++-----------------------------+--------+--------------------+-----------+--------------------------+------------+
+`
+	c.Assert(stdout.String(), check.Equals, expected)
+}
+
+func (s *S) TestAppHistoryJSON(c *check.C) {
+	defer func(f func() time.Time) { historyNow = f }(historyNow)
+	historyNow = fakeHistoryNow
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	client := cmd.NewClient(&http.Client{Transport: historyTransport(c, "20")}, nil, manager)
+	command := AppHistory{}
+	command.Flags().Parse(true, []string{"-a", "myapp", "--since", "72h", "--limit", "20", "--json"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	var entries []historyEntry
+	err = json.Unmarshal(stdout.Bytes(), &entries)
+	c.Assert(err, check.IsNil)
+	c.Assert(entries, check.HasLen, 5)
+	sources := make([]string, len(entries))
+	for i, e := range entries {
+		sources[i] = e.Source + ":" + e.Kind
+	}
+	c.Assert(strings.Join(sources, ","), check.Equals, "event:app.update,deploy:app-deploy,event:app.update.env.set,deploy:git,lock:lock")
+	c.Assert(entries[2].Error, check.Equals, "env failed\nmore details")
+	c.Assert(entries[4].Running, check.Equals, true)
+	c.Assert(entries[4].Duration, check.Equals, time.Minute)
+}
+
+func (s *S) TestAppHistoryInvalidSince(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	command := AppHistory{}
+	command.Flags().Parse(true, []string{"-a", "myapp", "--since", "0s"})
+	err := command.Run(&context, nil)
+	c.Assert(err, check.ErrorMatches, "The period given by --since must be greater than zero.")
+}
+
+func (s *S) TestAppHistoryInvalidLimit(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	command := AppHistory{}
+	command.Flags().Parse(true, []string{"-a", "myapp", "--limit", "0"})
+	err := command.Run(&context, nil)
+	c.Assert(err, check.ErrorMatches, "The limit given by --limit must be greater than zero.")
+}
@@ -79,6 +79,9 @@ func (c *KeyAdd) Run(context *cmd.Context, client *cmd.Client) error {
 	err = c.sendRequest(client, keyName, body, c.force)
 	if err != nil {
 		if e, ok := err.(*errors.HTTP); ok && e.Code == http.StatusConflict && !c.force {
+			if err = context.CheckInteractive(fmt.Sprintf("Do you want to replace the key %q?", keyName), "--force"); err != nil {
+				return err
+			}
 			var answer string
 			fmt.Fprintf(context.Stdout, "WARNING: key %q already exists.\nDo you want to replace it? (y/n) ", keyName)
 			fmt.Fscan(context.Stdin, &answer)
@@ -146,7 +146,7 @@ func (c *AppLog) Run(context *cmd.Context, client *cmd.Client) error {
 	if len(unparsed) > 0 {
 		fmt.Fprintf(context.Stdout, "Error: %s", string(unparsed))
 	}
-	return nil
+	return err
 }
 
 func (c *AppLog) Flags() *gnuflag.FlagSet {
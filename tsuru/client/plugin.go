@@ -115,7 +115,7 @@ func RunPlugin(context *cmd.Context) error {
 	if err != nil {
 		return err
 	}
-	token, err := cmd.ReadToken()
+	token, err := context.ReadToken()
 	if err != nil {
 		return err
 	}
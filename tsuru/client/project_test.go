@@ -0,0 +1,81 @@
+// Copyright 2017 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/check.v1"
+
+	"github.com/tsuru/tsuru/cmd"
+)
+
+// projectDir creates a directory with the given project file and a
+// subdirectory, changing the working directory to the subdirectory.
+func projectDir(c *check.C, project string) (string, func()) {
+	dir := c.MkDir()
+	err := ioutil.WriteFile(filepath.Join(dir, cmd.ProjectFileName), []byte(project), 0600)
+	c.Assert(err, check.IsNil)
+	sub := filepath.Join(dir, "src", "pkg")
+	err = os.MkdirAll(sub, 0755)
+	c.Assert(err, check.IsNil)
+	old, err := os.Getwd()
+	c.Assert(err, check.IsNil)
+	err = os.Chdir(sub)
+	c.Assert(err, check.IsNil)
+	return dir, func() { os.Chdir(old) }
+}
+
+func (s *S) TestProjectGuesser(c *check.C) {
+	dir, restore := projectDir(c, "app: myapp\nprocess: worker\n")
+	defer restore()
+	name, err := cmd.ProjectGuesser{}.GuessName(filepath.Join(dir, "src", "pkg"))
+	c.Assert(err, check.IsNil)
+	c.Assert(name, check.Equals, "myapp")
+	guessing := cmd.GuessingCommand{}
+	name, err = guessing.Guess()
+	c.Assert(err, check.IsNil)
+	c.Assert(name, check.Equals, "myapp")
+	err = ioutil.WriteFile(filepath.Join(dir, cmd.ProjectFileName), []byte("process: worker\n"), 0600)
+	c.Assert(err, check.IsNil)
+	_, err = cmd.ProjectGuesser{}.GuessName(dir)
+	c.Assert(err, check.ErrorMatches, `app not defined in .*/\.tsuru\.yaml\.`)
+	err = ioutil.WriteFile(filepath.Join(dir, cmd.ProjectFileName), []byte("app: [myapp\n"), 0600)
+	c.Assert(err, check.IsNil)
+	_, err = cmd.ProjectGuesser{}.GuessName(dir)
+	c.Assert(err, check.ErrorMatches, `invalid project file .*/\.tsuru\.yaml: .*`)
+	_, err = cmd.ProjectGuesser{}.GuessName(c.MkDir())
+	c.Assert(err, check.ErrorMatches, `\.tsuru\.yaml not found\.`)
+}
+
+func (s *S) TestGetTargetFromProject(c *check.C) {
+	defer tokenHome(c, map[string]string{"prod": "https://prod.example.com", "dev": "https://dev.example.com"})()
+	os.Unsetenv("TSURU_TARGET")
+	err := cmd.WriteTarget("https://dev.example.com")
+	c.Assert(err, check.IsNil)
+	dir, restore := projectDir(c, "app: myapp\ntarget: prod\n")
+	defer restore()
+	target, err := cmd.GetTarget()
+	c.Assert(err, check.IsNil)
+	c.Assert(target, check.Equals, "https://prod.example.com")
+	label, err := cmd.GetTargetLabel()
+	c.Assert(err, check.IsNil)
+	c.Assert(label, check.Equals, "prod")
+	os.Setenv("TSURU_TARGET", "https://dev.example.com")
+	target, err = cmd.GetTarget()
+	c.Assert(err, check.IsNil)
+	c.Assert(target, check.Equals, "https://dev.example.com")
+	os.Unsetenv("TSURU_TARGET")
+	err = ioutil.WriteFile(filepath.Join(dir, cmd.ProjectFileName), []byte("target: staging\n"), 0600)
+	c.Assert(err, check.IsNil)
+	_, err = cmd.GetTarget()
+	c.Assert(err, check.ErrorMatches, `the target "staging" of the project file .*/\.tsuru\.yaml is not in the target list, add it with target-add`)
+	os.Chdir(c.MkDir())
+	target, err = cmd.GetTarget()
+	c.Assert(err, check.IsNil)
+	c.Assert(target, check.Equals, "https://dev.example.com")
+}
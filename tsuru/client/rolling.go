@@ -0,0 +1,135 @@
+// Copyright 2017 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/tsuru/tsuru/cmd"
+)
+
+type rollingOptions struct {
+	enabled bool
+	batch   int
+	pause   time.Duration
+	timeout time.Duration
+}
+
+// rollingRestart replaces the units of the given process (or of every
+// process, when process is empty) in batches, by adding new units and
+// removing the same number of old units once the new ones are started, so
+// the process never has fewer started units than before the restart.
+func rollingRestart(context *cmd.Context, client *cmd.Client, appName, process string, opts rollingOptions) error {
+	if opts.batch < 1 {
+		return errors.New("The batch size must be greater than zero.")
+	}
+	a, err := loadApp(client, appName)
+	if err != nil {
+		return err
+	}
+	units := a.processUnits()
+	if process != "" && len(units[process]) == 0 {
+		return fmt.Errorf("App %q has no units of process %q.", appName, process)
+	}
+	if len(units) == 0 {
+		return fmt.Errorf("App %q has no units.", appName)
+	}
+	processes := []string{process}
+	if process == "" {
+		processes = make([]string, 0, len(units))
+		for p := range units {
+			processes = append(processes, p)
+		}
+		sort.Strings(processes)
+	}
+	for _, p := range processes {
+		err = rollingRestartProcess(context, client, appName, p, units[p], opts)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func rollingRestartProcess(context *cmd.Context, client *cmd.Client, appName, process string, units []unit, opts rollingOptions) error {
+	total := len(units)
+	old := make(map[string]bool, total)
+	for _, u := range units {
+		old[u.ID] = true
+	}
+	batchSize := opts.batch
+	if batchSize > total {
+		batchSize = total
+	}
+	batches := (total + batchSize - 1) / batchSize
+	fmt.Fprintf(context.Stdout, "Rolling restart of process %q: %d unit(s) in batches of %d.\n", process, total, batchSize)
+	for batch := 1; len(old) > 0; batch++ {
+		size := batchSize
+		if size > len(old) {
+			size = len(old)
+		}
+		abort := func(a *app, err error) error {
+			fmt.Fprintf(context.Stdout, "\nRolling restart aborted in batch %d of %d.\n", batch, batches)
+			if a != nil {
+				renderUnitCounts(context.Stdout, a)
+			}
+			return fmt.Errorf("rolling restart of process %q failed: %s", process, err)
+		}
+		fmt.Fprintf(context.Stdout, "\nBatch %d of %d: adding %d unit(s)...\n", batch, batches, size)
+		if err := addUnits(context, client, appName, process, size); err != nil {
+			return abort(nil, err)
+		}
+		a, err := waitForUnits(context, client, appName, opts.timeout, processReady(process, total+size))
+		if err != nil {
+			return abort(a, err)
+		}
+		fmt.Fprintf(context.Stdout, "Batch %d of %d: removing %d old unit(s)...\n", batch, batches, size)
+		if err = removeUnits(context, client, appName, process, size); err != nil {
+			return abort(a, err)
+		}
+		a, err = waitForUnits(context, client, appName, opts.timeout, processReady(process, total))
+		if err != nil {
+			return abort(a, err)
+		}
+		remaining := make(map[string]bool, len(old))
+		for _, u := range a.processUnits()[process] {
+			if old[u.ID] {
+				remaining[u.ID] = true
+			}
+		}
+		if len(remaining) == len(old) {
+			return abort(a, errors.New("no old units were removed, the provisioner removed the new units instead"))
+		}
+		old = remaining
+		if len(old) > 0 && opts.pause > 0 {
+			fmt.Fprintf(context.Stdout, "Waiting %s before the next batch...\n", opts.pause)
+			if err = sleep(context, opts.pause); err != nil {
+				return abort(a, err)
+			}
+		}
+	}
+	fmt.Fprintf(context.Stdout, "\nAll units of process %q were replaced.\n", process)
+	return nil
+}
+
+// processReady returns a condition for waitForUnits that is satisfied when
+// the process has exactly the given number of units, all of them started.
+func processReady(process string, count int) func(*app) bool {
+	return func(a *app) bool {
+		units := a.processUnits()[process]
+		if len(units) != count {
+			return false
+		}
+		for _, u := range units {
+			if !u.Available() {
+				return false
+			}
+		}
+		return true
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright 2017 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/cmd"
+	"gopkg.in/check.v1"
+)
+
+// fakeUnitsTransport simulates the units of a single process app, adding
+// units on PUT and removing them on DELETE.
+type fakeUnitsTransport struct {
+	units       []unit
+	next        int
+	newStatus   string
+	removeNewer bool
+	requests    []string
+}
+
+func (t *fakeUnitsTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.requests = append(t.requests, req.Method+" "+req.URL.Path)
+	body := `{"message":"ok\n"}` + "\n"
+	switch req.Method {
+	case "GET":
+		data, _ := json.Marshal(app{Name: "myapp", Units: t.units})
+		body = string(data)
+	case "PUT":
+		req.ParseForm()
+		n, _ := strconv.Atoi(req.Form.Get("units"))
+		for i := 0; i < n; i++ {
+			t.next++
+			t.units = append(t.units, unit{ID: fmt.Sprintf("new%d", t.next), Status: t.newStatus, ProcessName: req.Form.Get("process")})
+		}
+	case http.MethodDelete:
+		n, _ := strconv.Atoi(req.URL.Query().Get("units"))
+		if t.removeNewer {
+			t.units = t.units[:len(t.units)-n]
+		} else {
+			t.units = t.units[n:]
+		}
+	}
+	return &http.Response{
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+		StatusCode: http.StatusOK,
+	}, nil
+}
+
+func (s *S) TestAppRestartRolling(c *check.C) {
+	defer func(d time.Duration) { unitsPollInterval = d }(unitsPollInterval)
+	unitsPollInterval = time.Millisecond
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &fakeUnitsTransport{
+		newStatus: "started",
+		units: []unit{
+			{ID: "old1", Status: "started", ProcessName: "web"},
+			{ID: "old2", Status: "started", ProcessName: "web"},
+			{ID: "old3", Status: "started", ProcessName: "web"},
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppRestart{}
+	command.Flags().Parse(true, []string{"-a", "myapp", "--rolling", "--batch", "2"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(trans.units, check.HasLen, 3)
+	for _, u := range trans.units {
+		c.Assert(strings.HasPrefix(u.ID, "new"), check.Equals, true)
+	}
+	expected := `Rolling restart of process "web": 3 unit(s) in batches of 2.
+
+Batch 1 of 2: adding 2 unit(s)...
+ok
+Batch 1 of 2: removing 2 old unit(s)...
+ok
+
+Batch 2 of 2: adding 1 unit(s)...
+ok
+Batch 2 of 2: removing 1 old unit(s)...
+ok
+
+All units of process "web" were replaced.
+`
+	c.Assert(stdout.String(), check.Equals, expected)
+}
+
+func (s *S) TestAppRestartRollingNewUnitsNotStarted(c *check.C) {
+	defer func(d time.Duration) { unitsPollInterval = d }(unitsPollInterval)
+	unitsPollInterval = time.Millisecond
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &fakeUnitsTransport{
+		newStatus: "error",
+		units: []unit{
+			{ID: "old1", Status: "started", ProcessName: "web"},
+			{ID: "old2", Status: "started", ProcessName: "web"},
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppRestart{}
+	command.Flags().Parse(true, []string{"-a", "myapp", "-p", "web", "--rolling", "--timeout", "10ms"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.ErrorMatches, `rolling restart of process "web" failed: timeout after 10ms waiting for units of app "myapp"`)
+	c.Assert(stdout.String(), check.Matches, `(?s).*Rolling restart aborted in batch 1 of 2\..*\| web +\| 3 +\| 2 started, 1 error \|.*`)
+	for _, r := range trans.requests {
+		c.Assert(strings.HasPrefix(r, http.MethodDelete), check.Equals, false)
+	}
+}
+
+func (s *S) TestAppRestartRollingBatchLargerThanProcess(c *check.C) {
+	defer func(d time.Duration) { unitsPollInterval = d }(unitsPollInterval)
+	unitsPollInterval = time.Millisecond
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &fakeUnitsTransport{
+		newStatus: "started",
+		units: []unit{
+			{ID: "old1", Status: "started", ProcessName: "web"},
+			{ID: "old2", Status: "started", ProcessName: "web"},
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppRestart{}
+	command.Flags().Parse(true, []string{"-a", "myapp", "--rolling", "--batch", "5"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Matches, `(?s)Rolling restart of process "web": 2 unit\(s\) in batches of 2\.\n.*Batch 1 of 1: removing 2 old unit\(s\).*`)
+	c.Assert(trans.units, check.HasLen, 2)
+	for _, u := range trans.units {
+		c.Assert(strings.HasPrefix(u.ID, "new"), check.Equals, true)
+	}
+}
+
+func (s *S) TestAppRestartRollingSingleUnit(c *check.C) {
+	defer func(d time.Duration) { unitsPollInterval = d }(unitsPollInterval)
+	unitsPollInterval = time.Millisecond
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &fakeUnitsTransport{
+		newStatus: "started",
+		units:     []unit{{ID: "old1", Status: "started", ProcessName: "web"}},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppRestart{}
+	command.Flags().Parse(true, []string{"-a", "myapp", "--rolling"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(trans.units, check.DeepEquals, []unit{{ID: "new1", Status: "started", ProcessName: "web"}})
+	c.Assert(trans.requests, check.DeepEquals, []string{
+		"GET /1.0/apps/myapp",
+		"PUT /1.0/apps/myapp/units",
+		"GET /1.0/apps/myapp",
+		"DELETE /1.0/apps/myapp/units",
+		"GET /1.0/apps/myapp",
+	})
+}
+
+func (s *S) TestAppRestartRollingProvisionerRemovesNewUnits(c *check.C) {
+	defer func(d time.Duration) { unitsPollInterval = d }(unitsPollInterval)
+	unitsPollInterval = time.Millisecond
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &fakeUnitsTransport{
+		newStatus:   "started",
+		removeNewer: true,
+		units: []unit{
+			{ID: "old1", Status: "started", ProcessName: "web"},
+			{ID: "old2", Status: "started", ProcessName: "web"},
+		},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppRestart{}
+	command.Flags().Parse(true, []string{"-a", "myapp", "--rolling"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.ErrorMatches, `rolling restart of process "web" failed: no old units were removed.*`)
+}
+
+func (s *S) TestAppRestartRollingInvalidBatch(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	command := AppRestart{}
+	command.Flags().Parse(true, []string{"-a", "myapp", "--rolling", "--batch", "0"})
+	err := command.Run(&context, nil)
+	c.Assert(err, check.ErrorMatches, "The batch size must be greater than zero.")
+}
+
+func (s *S) TestAppRestartRollingUnknownProcess(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &fakeUnitsTransport{
+		units: []unit{{ID: "old1", Status: "started", ProcessName: "web"}},
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppRestart{}
+	command.Flags().Parse(true, []string{"-a", "myapp", "-p", "worker", "--rolling"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.ErrorMatches, `App "myapp" has no units of process "worker".`)
+	c.Assert(trans.requests, check.DeepEquals, []string{"GET /1.0/apps/myapp"})
+}
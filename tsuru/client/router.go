@@ -24,7 +24,7 @@ func (c *RoutersList) Info() *cmd.Info {
 }
 
 func (c *RoutersList) Run(context *cmd.Context, client *cmd.Client) error {
-	url, err := cmd.GetURLVersion("1.3", "/routers")
+	url, err := client.URLVersion("/routers", "1.3")
 	if err != nil {
 		return err
 	}
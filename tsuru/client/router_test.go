@@ -8,6 +8,8 @@ import (
 	"bytes"
 	"encoding/json"
 	"net/http"
+	"net/http/httptest"
+	"os"
 	"strings"
 
 	"github.com/tsuru/tsuru/cmd"
@@ -47,3 +49,28 @@ func (s *S) TestRoutersListRun(c *check.C) {
 	c.Assert(err, check.IsNil)
 	c.Assert(stdout.String(), check.Equals, expected)
 }
+
+func (s *S) TestRoutersListRunUnknownAPIVersion(c *check.C) {
+	defer tokenHome(c, nil)()
+	defer os.Setenv("TSURU_API_VERSION", os.Getenv("TSURU_API_VERSION"))
+	os.Unsetenv("TSURU_API_VERSION")
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path != "/1.3/routers" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`[{"name":"router1","type":"foo"}]`))
+	}))
+	defer server.Close()
+	os.Setenv("TSURU_TARGET", server.URL)
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{Stdout: &stdout, Stderr: &stderr}
+	client := cmd.NewClient(&http.Client{}, nil, manager)
+	command := RoutersList{}
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(stdout.String(), check.Matches, `(?s).*router1.*`)
+	c.Assert(paths, check.DeepEquals, []string{"/1.0/info", "/1.3/routers"})
+}
@@ -662,6 +662,9 @@ func (c *ServiceInstanceRemove) Run(ctx *cmd.Context, client *cmd.Client) error
 	instanceName := ctx.Args[1]
 	var answer string
 	if !c.yes {
+		if err := ctx.CheckInteractive(fmt.Sprintf(`Are you sure you want to remove service "%s"?`, instanceName), "-y"); err != nil {
+			return err
+		}
 		fmt.Fprintf(ctx.Stdout, `Are you sure you want to remove service "%s"? (y/n) `, instanceName)
 		fmt.Fscanf(ctx.Stdin, "%s", &answer)
 		if answer != "y" {
@@ -697,6 +700,9 @@ func (c *ServiceInstanceRemove) Run(ctx *cmd.Context, client *cmd.Client) error
 	if msgError != nil {
 		if msgError.Error() == service.ErrServiceInstanceBound.Error() {
 			fmt.Fprintf(ctx.Stdout, `Applications bound to the service "%s": "%s"`+"\n", instanceName, jsonMsg.Message)
+			if err := ctx.CheckInteractive("Do you want unbind all apps?", "--unbind"); err != nil {
+				return err
+			}
 			fmt.Fprintf(ctx.Stdout, `Do you want unbind all apps? (y/n) `)
 			fmt.Fscanf(ctx.Stdin, "%s", &answer)
 			if answer != "y" {
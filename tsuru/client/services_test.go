@@ -869,6 +869,28 @@ func (s *S) TestServiceInstanceRemoveWithAppBindNoUnbind(c *check.C) {
 	c.Assert(obtained, check.Equals, expected)
 }
 
+func (s *S) TestServiceInstanceRemoveNonInteractive(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	ctx := cmd.Context{
+		Args:           []string{"some-service-name", "mongodb"},
+		Stdout:         &stdout,
+		Stderr:         &stderr,
+		Stdin:          strings.NewReader("y\n"),
+		NonInteractive: true,
+	}
+	err := (&ServiceInstanceRemove{}).Run(&ctx, nil)
+	c.Assert(err, check.ErrorMatches, `unable to ask "Are you sure you want to remove service \\"mongodb\\"\?" in non-interactive mode, use -y to answer it`)
+	c.Assert(stdout.String(), check.Equals, "")
+	msg := io.SimpleJsonMessage{Message: "app1,app2", Error: "This service instance is bound to at least one app. Unbind them before removing it"}
+	result, err := json.Marshal(msg)
+	c.Assert(err, check.IsNil)
+	client := cmd.NewClient(&http.Client{Transport: &cmdtest.Transport{Message: string(result), Status: http.StatusOK}}, nil, manager)
+	command := ServiceInstanceRemove{}
+	command.Flags().Parse(true, []string{"-y"})
+	err = command.Run(&ctx, client)
+	c.Assert(err, check.ErrorMatches, `unable to ask "Do you want unbind all apps\?" in non-interactive mode, use --unbind to answer it`)
+}
+
 func (s *S) TestServiceInstanceRemoveWithAppBindYesUnbind(c *check.C) {
 	var stdout, stderr bytes.Buffer
 	expected := `Are you sure you want to remove service "mongodb"? (y/n) `
@@ -18,11 +18,13 @@ type S struct{}
 func (s *S) SetUpSuite(c *check.C) {
 	os.Setenv("TSURU_TARGET", "http://localhost:8080")
 	os.Setenv("TSURU_TOKEN", "sometoken")
+	os.Setenv("TSURU_API_VERSION", "1.3")
 }
 
 func (s *S) TearDownSuite(c *check.C) {
 	os.Unsetenv("TSURU_TARGET")
 	os.Unsetenv("TSURU_TOKEN")
+	os.Unsetenv("TSURU_API_VERSION")
 }
 
 var _ = check.Suite(&S{})
@@ -5,12 +5,15 @@
 package client
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/tsuru/gnuflag"
 	"github.com/tsuru/tsuru/cmd"
@@ -19,23 +22,39 @@ import (
 
 type AppSwap struct {
 	cmd.Command
-	force     bool
-	cnameOnly bool
-	fs        *gnuflag.FlagSet
+	force         bool
+	cnameOnly     bool
+	noVerify      bool
+	rollback      bool
+	verifyTimeout time.Duration
+	fs            *gnuflag.FlagSet
 }
 
 func (s *AppSwap) Info() *cmd.Info {
 	return &cmd.Info{
 		Name:  "app-swap",
-		Usage: "app-swap <app1-name> <app2-name> [-f/--force] [-c/--cname-only]",
+		Usage: "app-swap <app1-name> <app2-name> [-f/--force] [-c/--cname-only] [--no-verify] [--verify-timeout duration] [--rollback]",
 		Desc: `Swaps routing between two apps. This allows zero downtime and makes rollback
 as simple as swapping the applications back.
 
+Before swapping, both apps are compared side by side: platform, plan, pool,
+units, service instances, addresses and the cnames that will move between
+them, along with the environment variables defined in only one of the apps.
+The swap is refused when an app that is about to receive the cnames of the
+other one has no started units.
+
 Use [[--force]] if you want to swap applications with a different number of
-units or different platform without confirmation.
+units or different platform without confirmation, or to swap to an app
+without started units.
 
 Use [[--cname-only]] if you want to swap all cnames except the default
-cname of application`,
+cname of application
+
+After the swap, the command checks that the routes have moved and that the
+addresses of both apps respond, for up to [[--verify-timeout]]. When the
+verification fails, it offers to swap the apps back. Use [[--rollback]] to
+swap the apps back without confirmation and [[--no-verify]] to skip this
+verification.`,
 		MinArgs: 2,
 	}
 }
@@ -47,45 +66,330 @@ func (s *AppSwap) Flags() *gnuflag.FlagSet {
 		s.fs.BoolVar(&s.force, "f", false, "Force Swap among apps with different number of units or different platform.")
 		s.fs.BoolVar(&s.cnameOnly, "cname-only", false, "Swap all cnames except the default cname.")
 		s.fs.BoolVar(&s.cnameOnly, "c", false, "Swap all cnames except the default cname.")
+		s.fs.BoolVar(&s.noVerify, "no-verify", false, "Don't verify the routes of the apps after the swap.")
+		s.fs.BoolVar(&s.rollback, "rollback", false, "Swap the apps back without confirmation when the verification fails.")
+		s.fs.DurationVar(&s.verifyTimeout, "verify-timeout", time.Minute, "Maximum time to wait for the routes to move after the swap.")
 	}
 	return s.fs
 }
 
 func (s *AppSwap) Run(context *cmd.Context, client *cmd.Client) error {
+	var app1, app2 *app
+	err := fetchAll(client,
+		func() error {
+			var err error
+			app1, err = loadApp(client, context.Args[0])
+			return err
+		},
+		func() error {
+			var err error
+			app2, err = loadApp(client, context.Args[1])
+			return err
+		},
+	)
+	if err != nil {
+		return err
+	}
+	err = s.compare(context, client, app1, app2)
+	if err != nil {
+		return err
+	}
+	if !s.force {
+		for _, a := range swapIncoming(app1, app2, s.cnameOnly) {
+			if len(startedUnits(a)) == 0 {
+				return fmt.Errorf("App %q has no started units and would receive the routes of the other app. Use --force to swap anyway.", a.Name)
+			}
+		}
+	}
+	err = s.swap(client, app1.Name, app2.Name, s.force)
+	if err != nil {
+		e, ok := err.(*errors.HTTP)
+		if !ok || e.Code != http.StatusPreconditionFailed {
+			return err
+		}
+		if err = context.CheckInteractive("Swap anyway?", "--force"); err != nil {
+			return fmt.Errorf("%s: %s", strings.TrimRight(e.Message, "\n"), err)
+		}
+		var answer string
+		fmt.Fprintf(context.Stdout, "WARNING: %s.\nSwap anyway? (y/n) ", strings.TrimRight(e.Message, "\n"))
+		fmt.Fscanf(context.Stdin, "%s", &answer)
+		if answer != "y" && answer != "yes" {
+			fmt.Fprintln(context.Stdout, "swap aborted.")
+			return nil
+		}
+		if err = s.swap(client, app1.Name, app2.Name, true); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintln(context.Stdout, "Apps successfully swapped!")
+	if s.noVerify {
+		return nil
+	}
+	fmt.Fprintln(context.Stdout, "Verifying the routes of the apps...")
+	err = verifySwap(context, client, app1, app2, s.cnameOnly, s.verifyTimeout)
+	if err == nil {
+		fmt.Fprintln(context.Stdout, "Routes verified.")
+		return nil
+	}
+	if !s.rollback {
+		if promptErr := context.CheckInteractive("Swap the apps back?", "--rollback"); promptErr != nil {
+			return fmt.Errorf("swap verification failed: %s: %s", err, promptErr)
+		}
+		var answer string
+		fmt.Fprintf(context.Stdout, "WARNING: verification failed: %s.\nSwap the apps back? (y/n) ", err)
+		fmt.Fscanf(context.Stdin, "%s", &answer)
+		if answer != "y" && answer != "yes" {
+			return fmt.Errorf("swap verification failed: %s", err)
+		}
+	} else {
+		fmt.Fprintf(context.Stdout, "WARNING: verification failed: %s.\nSwapping the apps back...\n", err)
+	}
+	if swapErr := s.swap(client, app1.Name, app2.Name, true); swapErr != nil {
+		return fmt.Errorf("swap verification failed: %s. Swapping the apps back also failed: %s", err, swapErr)
+	}
+	fmt.Fprintln(context.Stdout, "Apps swapped back.")
+	return fmt.Errorf("swap verification failed: %s", err)
+}
+
+func (s *AppSwap) swap(client *cmd.Client, app1, app2 string, force bool) error {
 	v := url.Values{}
-	v.Set("app1", context.Args[0])
-	v.Set("app2", context.Args[1])
-	v.Set("force", strconv.FormatBool(s.force))
+	v.Set("app1", app1)
+	v.Set("app2", app2)
+	v.Set("force", strconv.FormatBool(force))
 	v.Set("cnameOnly", strconv.FormatBool(s.cnameOnly))
 	u, err := cmd.GetURL("/swap")
 	if err != nil {
 		return err
 	}
-	err = makeSwap(client, u, strings.NewReader(v.Encode()))
-	if err != nil {
-		if e, ok := err.(*errors.HTTP); ok && e.Code == http.StatusPreconditionFailed {
-			var answer string
-			fmt.Fprintf(context.Stdout, "WARNING: %s.\nSwap anyway? (y/n) ", strings.TrimRight(e.Message, "\n"))
-			fmt.Fscanf(context.Stdin, "%s", &answer)
-			if answer == "y" || answer == "yes" {
-				v = url.Values{}
-				v.Set("app1", context.Args[0])
-				v.Set("app2", context.Args[1])
-				v.Set("force", "true")
-				v.Set("cnameOnly", strconv.FormatBool(s.cnameOnly))
-				u, err = cmd.GetURL("/swap")
-				if err != nil {
-					return err
-				}
-				return makeSwap(client, u, strings.NewReader(v.Encode()))
+	return makeSwap(client, u, strings.NewReader(v.Encode()))
+}
+
+// compare prints both apps side by side, along with the environment
+// variables defined in only one of them and the cnames that will move.
+func (s *AppSwap) compare(context *cmd.Context, client *cmd.Client, app1, app2 *app) error {
+	apps := []*app{app1, app2}
+	envs := make([]map[string]bool, len(apps))
+	services := make([]string, len(apps))
+	var fns []func() error
+	for i, a := range apps {
+		i, a := i, a
+		fns = append(fns, func() error {
+			var err error
+			envs[i], err = loadEnvNames(client, a.Name)
+			return err
+		}, func() error {
+			var err error
+			services[i], err = loadServiceBindings(client, a.Name)
+			return err
+		})
+	}
+	if err := fetchAll(client, fns...); err != nil {
+		return err
+	}
+	table := cmd.NewTable()
+	table.Headers = cmd.Row([]string{"", app1.Name, app2.Name})
+	table.AddRow(cmd.Row([]string{"Platform", app1.Platform, app2.Platform}))
+	table.AddRow(cmd.Row([]string{"Plan", app1.Plan.Name, app2.Plan.Name}))
+	table.AddRow(cmd.Row([]string{"Pool", app1.Pool, app2.Pool}))
+	table.AddRow(cmd.Row([]string{"Units", unitSummary(app1), unitSummary(app2)}))
+	table.AddRow(cmd.Row([]string{"Services", services[0], services[1]}))
+	table.AddRow(cmd.Row([]string{"Cnames", strings.Join(app1.CName, "\n"), strings.Join(app2.CName, "\n")}))
+	table.AddRow(cmd.Row([]string{"Address", app1.IP, app2.IP}))
+	context.Stdout.Write(table.Bytes())
+	for i, a := range apps {
+		var only []string
+		for name := range envs[i] {
+			if !envs[1-i][name] {
+				only = append(only, name)
 			}
-			fmt.Fprintln(context.Stdout, "swap aborted.")
+		}
+		if len(only) > 0 {
+			sort.Strings(only)
+			fmt.Fprintf(context.Stdout, "Environment variables only in %q: %s\n", a.Name, strings.Join(only, ", "))
+		}
+	}
+	for i, a := range apps {
+		other := apps[1-i]
+		if len(a.CName) > 0 {
+			fmt.Fprintf(context.Stdout, "Cnames moving from %q to %q: %s\n", a.Name, other.Name, strings.Join(a.CName, ", "))
+		}
+		if !s.cnameOnly && a.IP != "" {
+			fmt.Fprintf(context.Stdout, "Address %q will route to %q.\n", a.IP, other.Name)
+		}
+	}
+	return nil
+}
+
+func loadEnvNames(client *cmd.Client, appName string) (map[string]bool, error) {
+	result, err := getFromURL(fmt.Sprintf("/apps/%s/env", appName), client)
+	if err != nil {
+		return nil, err
+	}
+	var variables []struct{ Name string }
+	if len(result) > 0 {
+		if err = json.Unmarshal(result, &variables); err != nil {
+			return nil, err
+		}
+	}
+	names := make(map[string]bool, len(variables))
+	for _, v := range variables {
+		names[v.Name] = true
+	}
+	return names, nil
+}
+
+// loadServiceBindings returns the service instances bound to the app, one
+// service per line.
+func loadServiceBindings(client *cmd.Client, appName string) (string, error) {
+	result, err := getFromURL(fmt.Sprintf("/services/instances?app=%s", appName), client)
+	if err != nil {
+		return "", err
+	}
+	var services []serviceData
+	if len(result) > 0 {
+		if err = json.Unmarshal(result, &services); err != nil {
+			return "", err
+		}
+	}
+	var lines []string
+	for _, s := range services {
+		if len(s.Instances) > 0 {
+			instances := append([]string(nil), s.Instances...)
+			sort.Strings(instances)
+			lines = append(lines, fmt.Sprintf("%s: %s", s.Service, strings.Join(instances, ", ")))
+		}
+	}
+	sort.Strings(lines)
+	return strings.Join(lines, "\n"), nil
+}
+
+// unitSummary returns the units of the app by process and status, one
+// process per line.
+func unitSummary(a *app) string {
+	units := a.processUnits()
+	processes := make([]string, 0, len(units))
+	for process := range units {
+		processes = append(processes, process)
+	}
+	sort.Strings(processes)
+	lines := make([]string, len(processes))
+	for i, process := range processes {
+		lines[i] = fmt.Sprintf("%s: %s", process, unitStatusText(units[process]))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func startedUnits(a *app) []unit {
+	var started []unit
+	for _, u := range a.Units {
+		if u.ID != "" && u.Available() {
+			started = append(started, u)
+		}
+	}
+	return started
+}
+
+// swapIncoming returns the apps that will receive the public routes of the
+// other app: the ones receiving cnames or, when there are no cnames and the
+// addresses are swapped too, both apps.
+func swapIncoming(app1, app2 *app, cnameOnly bool) []*app {
+	var incoming []*app
+	if len(app2.CName) > 0 {
+		incoming = append(incoming, app1)
+	}
+	if len(app1.CName) > 0 {
+		incoming = append(incoming, app2)
+	}
+	if len(incoming) == 0 && !cnameOnly {
+		incoming = []*app{app1, app2}
+	}
+	return incoming
+}
+
+// swapPollInterval is the interval between checks when verifying the routes
+// of the apps after a swap.
+var swapPollInterval = 2 * time.Second
+
+// verifySwap waits for the cnames (and, unless cnameOnly is set, the
+// addresses) of the apps to be exchanged in the API and for the addresses of
+// both apps to respond.
+func verifySwap(context *cmd.Context, client *cmd.Client, before1, before2 *app, cnameOnly bool, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := checkSwap(context, client, before1, before2, cnameOnly)
+		if err == nil {
 			return nil
 		}
+		if time.Now().Add(swapPollInterval).After(deadline) {
+			return err
+		}
+		if err = sleep(context, swapPollInterval); err != nil {
+			return err
+		}
+	}
+}
+
+func checkSwap(context *cmd.Context, client *cmd.Client, before1, before2 *app, cnameOnly bool) error {
+	after1, err := loadApp(client, before1.Name)
+	if err != nil {
+		return err
+	}
+	after2, err := loadApp(client, before2.Name)
+	if err != nil {
+		return err
+	}
+	pairs := [][2]*app{{after1, before2}, {after2, before1}}
+	for _, p := range pairs {
+		after, before := p[0], p[1]
+		if !sameStrings(after.CName, before.CName) {
+			return fmt.Errorf("cnames of app %q were not moved", after.Name)
+		}
+		if !cnameOnly && after.IP != before.IP {
+			return fmt.Errorf("address of app %q was not moved", after.Name)
+		}
+	}
+	for _, a := range []*app{after1, after2} {
+		if a.IP == "" {
+			continue
+		}
+		if err = addressResponds(context, a.IP); err != nil {
+			return fmt.Errorf("address of app %q is not responding: %s", a.Name, err)
+		}
+	}
+	return nil
+}
+
+// addressResponds returns an error if the address can't be reached or
+// responds with a server error.
+func addressResponds(context *cmd.Context, address string) error {
+	if !strings.HasPrefix(address, "http://") && !strings.HasPrefix(address, "https://") {
+		address = "http://" + address
+	}
+	response, err := getAddress(context, address)
+	if err != nil {
 		return err
 	}
-	fmt.Fprintln(context.Stdout, "Apps successfully swapped!")
-	return err
+	defer response.Body.Close()
+	if response.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("GET %s returned %s", address, response.Status)
+	}
+	return nil
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string(nil), a...)
+	b = append([]string(nil), b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
 }
 
 func makeSwap(client *cmd.Client, url string, body io.Reader) error {
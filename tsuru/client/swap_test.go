@@ -6,11 +6,15 @@ package client
 
 import (
 	"bytes"
+	"encoding/json"
+	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"strings"
+	"time"
 
 	"github.com/tsuru/tsuru/cmd"
-	"github.com/tsuru/tsuru/cmd/cmdtest"
 	"gopkg.in/check.v1"
 )
 
@@ -19,33 +23,90 @@ func (s *S) TestSwapInfo(c *check.C) {
 	c.Assert(command.Info(), check.NotNil)
 }
 
-func (s *S) TestSwap(c *check.C) {
-	var buf bytes.Buffer
-	var called bool
-	transport := cmdtest.ConditionalTransport{
-		Transport: cmdtest.Transport{Status: http.StatusOK, Message: ""},
-		CondFunc: func(r *http.Request) bool {
-			called = true
-			app1Name := r.FormValue("app1") == "app1"
-			app2Name := r.FormValue("app2") == "app2"
-			forceSwap := r.FormValue("force") == "false"
-			cnameOnly := r.FormValue("cnameOnly") == "false"
-			method := r.Method == "POST"
-			url := strings.HasSuffix(r.URL.Path, "/swap")
-			return url && method && cnameOnly && forceSwap && app2Name && app1Name
+// fakeSwapTransport serves two apps, exchanging their cnames and addresses
+// on swap.
+type fakeSwapTransport struct {
+	apps        map[string]*app
+	envs        map[string]string
+	services    map[string]string
+	swapStatus  []int
+	swaps       []url.Values
+	ignoreSwaps bool
+}
+
+func (t *fakeSwapTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	parts := strings.Split(req.URL.Path, "/")
+	status := http.StatusOK
+	var body string
+	switch {
+	case req.Method == "POST" && strings.HasSuffix(req.URL.Path, "/swap"):
+		req.ParseForm()
+		if len(t.swaps) < len(t.swapStatus) {
+			status = t.swapStatus[len(t.swaps)]
+		}
+		t.swaps = append(t.swaps, req.Form)
+		if status != http.StatusOK {
+			body = "Apps are not equal"
+		} else if !t.ignoreSwaps {
+			app1, app2 := t.apps[req.Form.Get("app1")], t.apps[req.Form.Get("app2")]
+			app1.CName, app2.CName = app2.CName, app1.CName
+			if req.Form.Get("cnameOnly") != "true" {
+				app1.IP, app2.IP = app2.IP, app1.IP
+			}
+		}
+	case strings.HasSuffix(req.URL.Path, "/services/instances"):
+		body = t.services[req.URL.Query().Get("app")]
+	case len(parts) == 5 && parts[4] == "env":
+		body = t.envs[parts[3]]
+	case len(parts) == 4 && parts[2] == "apps":
+		data, _ := json.Marshal(t.apps[parts[3]])
+		body = string(data)
+	default:
+		status = http.StatusNotFound
+	}
+	return &http.Response{
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+		StatusCode: status,
+	}, nil
+}
+
+// newFakeSwapTransport returns a transport serving app1, owning a cname, and
+// app2, each one with an address served by a test HTTP server.
+func newFakeSwapTransport() (*fakeSwapTransport, func()) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	server1 := httptest.NewServer(handler)
+	server2 := httptest.NewServer(handler)
+	trans := &fakeSwapTransport{
+		apps: map[string]*app{
+			"app1": {Name: "app1", IP: strings.TrimPrefix(server1.URL, "http://"), CName: []string{"www.example.com"}, Units: []unit{{ID: "u1", Status: "started", ProcessName: "web"}}},
+			"app2": {Name: "app2", IP: strings.TrimPrefix(server2.URL, "http://"), Units: []unit{{ID: "u2", Status: "started", ProcessName: "web"}}},
 		},
 	}
+	return trans, func() {
+		server1.Close()
+		server2.Close()
+	}
+}
+
+func (s *S) TestSwap(c *check.C) {
+	var buf bytes.Buffer
+	trans, closeServers := newFakeSwapTransport()
+	defer closeServers()
 	context := cmd.Context{
 		Args:   []string{"app1", "app2"},
 		Stdout: &buf,
 	}
-	client := cmd.NewClient(&http.Client{Transport: &transport}, nil, manager)
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
 	command := AppSwap{}
+	command.Flags().Parse(true, nil)
 	err := command.Run(&context, client)
 	c.Assert(err, check.IsNil)
-	c.Assert(called, check.Equals, true)
-	expected := "Apps successfully swapped!\n"
-	c.Assert(buf.String(), check.Equals, expected)
+	c.Assert(trans.swaps, check.HasLen, 1)
+	c.Assert(trans.swaps[0].Get("app1"), check.Equals, "app1")
+	c.Assert(trans.swaps[0].Get("app2"), check.Equals, "app2")
+	c.Assert(trans.swaps[0].Get("force"), check.Equals, "false")
+	c.Assert(trans.swaps[0].Get("cnameOnly"), check.Equals, "false")
+	c.Assert(buf.String(), check.Matches, "(?s).*\nApps successfully swapped!\nVerifying the routes of the apps...\nRoutes verified.\n")
 }
 
 func (s *S) TestSwapFlags(c *check.C) {
@@ -65,81 +126,220 @@ func (s *S) TestSwapFlags(c *check.C) {
 	c.Check(cname.Usage, check.Equals, "Swap all cnames except the default cname.")
 	c.Check(cname.Value.String(), check.Equals, "true")
 	c.Check(cname.DefValue, check.Equals, "false")
+	noVerify := flagset.Lookup("no-verify")
+	c.Check(noVerify, check.NotNil)
+	c.Check(noVerify.DefValue, check.Equals, "false")
+	verifyTimeout := flagset.Lookup("verify-timeout")
+	c.Check(verifyTimeout, check.NotNil)
+	c.Check(verifyTimeout.DefValue, check.Equals, "1m0s")
 }
 
 func (s *S) TestSwapCnameOnlyFlag(c *check.C) {
 	var buf bytes.Buffer
-	var called bool
-	transport := cmdtest.ConditionalTransport{
-		Transport: cmdtest.Transport{Status: http.StatusOK, Message: ""},
-		CondFunc: func(r *http.Request) bool {
-			called = true
-			app1Name := r.FormValue("app1") == "app1"
-			app2Name := r.FormValue("app2") == "app2"
-			forceSwap := r.FormValue("force") == "false"
-			cnameOnly := r.FormValue("cnameOnly") == "true"
-			method := r.Method == "POST"
-			url := strings.HasSuffix(r.URL.Path, "/swap")
-			return url && method && cnameOnly && forceSwap && app2Name && app1Name
-		},
-	}
+	trans, closeServers := newFakeSwapTransport()
+	defer closeServers()
 	context := cmd.Context{
 		Args:   []string{"app1", "app2"},
 		Stdout: &buf,
 	}
-	client := cmd.NewClient(&http.Client{Transport: &transport}, nil, manager)
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
 	command := AppSwap{}
 	command.Flags().Parse(true, []string{"-c"})
 	err := command.Run(&context, client)
 	c.Assert(err, check.IsNil)
-	c.Assert(called, check.Equals, true)
-	expected := "Apps successfully swapped!\n"
-	c.Assert(buf.String(), check.Equals, expected)
+	c.Assert(trans.swaps, check.HasLen, 1)
+	c.Assert(trans.swaps[0].Get("force"), check.Equals, "false")
+	c.Assert(trans.swaps[0].Get("cnameOnly"), check.Equals, "true")
+	c.Assert(trans.apps["app2"].CName, check.DeepEquals, []string{"www.example.com"})
+	c.Assert(buf.String(), check.Matches, "(?s).*\nApps successfully swapped!\nVerifying the routes of the apps...\nRoutes verified.\n")
 }
 
 func (s *S) TestSwapWhenAppsAreNotEqual(c *check.C) {
 	var buf bytes.Buffer
-	var called int
-	stdin := bytes.NewBufferString("yes")
-	transportError := cmdtest.ConditionalTransport{
-		Transport: cmdtest.Transport{Status: http.StatusPreconditionFailed, Message: "Apps are not equal."},
-		CondFunc: func(r *http.Request) bool {
-			called++
-			app1Name := r.FormValue("app1") == "app1"
-			app2Name := r.FormValue("app2") == "app2"
-			forceSwap := r.FormValue("force") == "false"
-			cnameOnly := r.FormValue("cnameOnly") == "false"
-			method := r.Method == "POST"
-			url := strings.HasSuffix(r.URL.Path, "/swap")
-			return url && method && cnameOnly && forceSwap && app2Name && app1Name
-		},
+	trans, closeServers := newFakeSwapTransport()
+	defer closeServers()
+	trans.swapStatus = []int{http.StatusPreconditionFailed, http.StatusOK}
+	context := cmd.Context{
+		Args:   []string{"app1", "app2"},
+		Stdout: &buf,
+		Stdin:  bytes.NewBufferString("yes"),
 	}
-	transportOk := cmdtest.ConditionalTransport{
-		Transport: cmdtest.Transport{Status: http.StatusOK, Message: ""},
-		CondFunc: func(r *http.Request) bool {
-			called++
-			app1Name := r.FormValue("app1") == "app1"
-			app2Name := r.FormValue("app2") == "app2"
-			forceSwap := r.FormValue("force") == "true"
-			cnameOnly := r.FormValue("cnameOnly") == "false"
-			method := r.Method == "POST"
-			url := strings.HasSuffix(r.URL.Path, "/swap")
-			return url && method && cnameOnly && forceSwap && app2Name && app1Name
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppSwap{}
+	command.Flags().Parse(true, []string{"--no-verify"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(trans.swaps, check.HasLen, 2)
+	c.Assert(trans.swaps[0].Get("force"), check.Equals, "false")
+	c.Assert(trans.swaps[1].Get("force"), check.Equals, "true")
+	c.Assert(buf.String(), check.Matches, "(?s).*WARNING: Apps are not equal\\.\nSwap anyway\\? \\(y/n\\) Apps successfully swapped!\n")
+}
+
+func (s *S) TestSwapComparison(c *check.C) {
+	var buf bytes.Buffer
+	trans := &fakeSwapTransport{
+		apps: map[string]*app{
+			"blue":  {Name: "blue", IP: "blue.tsuru.io", CName: []string{"www.example.com"}, Platform: "python", Pool: "prod", Units: []unit{{ID: "b1", Status: "started", ProcessName: "web"}, {ID: "b2", Status: "started", ProcessName: "worker"}}},
+			"green": {Name: "green", IP: "green.tsuru.io", Platform: "python3", Pool: "prod", Units: []unit{{ID: "g1", Status: "started", ProcessName: "web"}, {ID: "g2", Status: "error", ProcessName: "web"}}},
+		},
+		envs: map[string]string{
+			"blue":  `[{"name":"DATABASE_URL","value":"x","public":false},{"name":"DEBUG","value":"1","public":true}]`,
+			"green": `[{"name":"DATABASE_URL","value":"y","public":false},{"name":"NEW_FLAG","value":"1","public":true}]`,
+		},
+		services: map[string]string{
+			"blue":  `[{"service":"mysql","instances":["db"]},{"service":"redis","instances":[]}]`,
+			"green": `[{"service":"mysql","instances":["db"]}]`,
 		},
 	}
-	multiTransport := cmdtest.MultiConditionalTransport{
-		ConditionalTransports: []cmdtest.ConditionalTransport{transportError, transportOk},
+	context := cmd.Context{
+		Args:   []string{"blue", "green"},
+		Stdout: &buf,
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppSwap{}
+	command.Flags().Parse(true, []string{"--no-verify"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	expected := `+----------+-------------------+-------------------------+
+|          | blue              | green                   |
++----------+-------------------+-------------------------+
+| Platform | python            | python3                 |
+| Plan     |                   |                         |
+| Pool     | prod              | prod                    |
+| Units    | web: 1 started    | web: 1 error, 1 started |
+|          | worker: 1 started |                         |
+| Services | mysql: db         | mysql: db               |
+| Cnames   | www.example.com   |                         |
+| Address  | blue.tsuru.io     | green.tsuru.io          |
++----------+-------------------+-------------------------+
+Environment variables only in "blue": DEBUG
+Environment variables only in "green": NEW_FLAG
+Cnames moving from "blue" to "green": www.example.com
+Address "blue.tsuru.io" will route to "green".
+Address "green.tsuru.io" will route to "blue".
+Apps successfully swapped!
+`
+	c.Assert(buf.String(), check.Equals, expected)
+}
+
+func (s *S) TestSwapRefusesWithoutStartedUnits(c *check.C) {
+	var buf bytes.Buffer
+	trans, closeServers := newFakeSwapTransport()
+	defer closeServers()
+	trans.apps["app2"].Units = []unit{{ID: "u2", Status: "stopped", ProcessName: "web"}}
+	context := cmd.Context{
+		Args:   []string{"app1", "app2"},
+		Stdout: &buf,
 	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppSwap{}
+	command.Flags().Parse(true, nil)
+	err := command.Run(&context, client)
+	c.Assert(err, check.ErrorMatches, `App "app2" has no started units and would receive the routes of the other app. Use --force to swap anyway.`)
+	c.Assert(trans.swaps, check.HasLen, 0)
+}
+
+func (s *S) TestSwapWithoutStartedUnitsForce(c *check.C) {
+	var buf bytes.Buffer
+	trans, closeServers := newFakeSwapTransport()
+	defer closeServers()
+	trans.apps["app2"].Units = nil
 	context := cmd.Context{
 		Args:   []string{"app1", "app2"},
 		Stdout: &buf,
-		Stdin:  stdin,
 	}
-	client := cmd.NewClient(&http.Client{Transport: &multiTransport}, nil, manager)
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
 	command := AppSwap{}
+	command.Flags().Parse(true, []string{"-f"})
 	err := command.Run(&context, client)
 	c.Assert(err, check.IsNil)
-	c.Assert(called, check.Equals, 2)
+	c.Assert(trans.swaps, check.HasLen, 1)
+	c.Assert(trans.swaps[0].Get("force"), check.Equals, "true")
+}
+
+func (s *S) TestSwapVerificationFailedSwapBack(c *check.C) {
+	defer func(d time.Duration) { swapPollInterval = d }(swapPollInterval)
+	swapPollInterval = time.Millisecond
+	var buf bytes.Buffer
+	trans, closeServers := newFakeSwapTransport()
+	defer closeServers()
+	trans.ignoreSwaps = true
+	context := cmd.Context{
+		Args:   []string{"app1", "app2"},
+		Stdout: &buf,
+		Stdin:  bytes.NewBufferString("y\n"),
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppSwap{}
+	command.Flags().Parse(true, []string{"--verify-timeout", "10ms"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.ErrorMatches, `swap verification failed: cnames of app "app1" were not moved`)
+	c.Assert(trans.swaps, check.HasLen, 2)
+	c.Assert(trans.swaps[1].Get("force"), check.Equals, "true")
+	c.Assert(buf.String(), check.Matches, "(?s).*Swap the apps back\\? \\(y/n\\) Apps swapped back.\n")
+}
+
+func (s *S) TestSwapVerificationFailedKeepSwap(c *check.C) {
+	defer func(d time.Duration) { swapPollInterval = d }(swapPollInterval)
+	swapPollInterval = time.Millisecond
+	var buf bytes.Buffer
+	trans, closeServers := newFakeSwapTransport()
+	defer closeServers()
+	trans.apps["app2"].IP = "127.0.0.1:1"
+	context := cmd.Context{
+		Args:   []string{"app1", "app2"},
+		Stdout: &buf,
+		Stdin:  bytes.NewBufferString("n\n"),
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppSwap{}
+	command.Flags().Parse(true, []string{"--verify-timeout", "10ms"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.ErrorMatches, `swap verification failed: address of app "app1" is not responding: .*`)
+	c.Assert(trans.swaps, check.HasLen, 1)
+}
+
+func (s *S) TestSwapVerificationFailedNonInteractive(c *check.C) {
+	defer func(d time.Duration) { swapPollInterval = d }(swapPollInterval)
+	swapPollInterval = time.Millisecond
+	var buf bytes.Buffer
+	trans, closeServers := newFakeSwapTransport()
+	defer closeServers()
+	trans.ignoreSwaps = true
+	context := cmd.Context{
+		Args:           []string{"app1", "app2"},
+		Stdout:         &buf,
+		Stdin:          bytes.NewBufferString("y\n"),
+		NonInteractive: true,
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppSwap{}
+	command.Flags().Parse(true, []string{"--verify-timeout", "10ms"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.ErrorMatches, `swap verification failed: cnames of app "app1" were not moved: unable to ask "Swap the apps back\?" in non-interactive mode, use --rollback to answer it`)
+	c.Assert(trans.swaps, check.HasLen, 1)
+}
+
+func (s *S) TestSwapVerificationFailedRollback(c *check.C) {
+	defer func(d time.Duration) { swapPollInterval = d }(swapPollInterval)
+	swapPollInterval = time.Millisecond
+	var buf bytes.Buffer
+	trans, closeServers := newFakeSwapTransport()
+	defer closeServers()
+	trans.ignoreSwaps = true
+	context := cmd.Context{
+		Args:           []string{"app1", "app2"},
+		Stdout:         &buf,
+		NonInteractive: true,
+	}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppSwap{}
+	command.Flags().Parse(true, []string{"--verify-timeout", "10ms", "--rollback"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.ErrorMatches, `swap verification failed: cnames of app "app1" were not moved`)
+	c.Assert(trans.swaps, check.HasLen, 2)
+	c.Assert(trans.swaps[1].Get("force"), check.Equals, "true")
+	c.Assert(buf.String(), check.Matches, "(?s).*Swapping the apps back...\nApps swapped back.\n")
 }
 
 func (s *S) TestSwapIsACommand(c *check.C) {
@@ -33,11 +33,20 @@ func (t *TagList) Info() *cmd.Info {
 }
 
 func (t *TagList) Run(context *cmd.Context, client *cmd.Client) error {
-	apps, err := loadApps(client)
-	if err != nil {
-		return err
-	}
-	services, err := loadServices(client)
+	var apps []app
+	var services []service.ServiceModel
+	err := fetchAll(client,
+		func() error {
+			var err error
+			apps, err = loadApps(client)
+			return err
+		},
+		func() error {
+			var err error
+			services, err = loadServices(client)
+			return err
+		},
+	)
 	if err != nil {
 		return err
 	}
@@ -6,7 +6,15 @@ package client
 
 import (
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
 
 	"github.com/tsuru/tsuru/cmd"
 	"github.com/tsuru/tsuru/cmd/cmdtest"
@@ -123,15 +131,107 @@ func (s *S) TestTagListRequestError(c *check.C) {
 }
 
 func makeClient(messages []string) *cmd.Client {
-	trueFunc := func(*http.Request) bool { return true }
+	paths := []string{"/1.0/apps", "/1.0/services"}
 	cts := make([]cmdtest.ConditionalTransport, len(messages))
 	for i, message := range messages {
+		path := paths[i]
 		cts[i] = cmdtest.ConditionalTransport{
 			Transport: cmdtest.Transport{Message: message, Status: http.StatusOK},
-			CondFunc:  trueFunc,
+			CondFunc:  func(req *http.Request) bool { return req.URL.Path == path },
 		}
 	}
 	return cmd.NewClient(&http.Client{
-		Transport: &cmdtest.MultiConditionalTransport{ConditionalTransports: cts},
+		Transport: &cmdtest.AnyConditionalTransport{ConditionalTransports: cts},
 	}, nil, manager)
 }
+
+// apiServer is a TLS server answering the requests of tag-list and
+// app-info, used to compare clients with and without connection reuse.
+type apiServer struct {
+	*httptest.Server
+	conns  int64
+	closes int64
+	target string
+}
+
+func newAPIServer() *apiServer {
+	s := &apiServer{}
+	responses := map[string]string{
+		"/1.0/apps":               `[{"name":"app1","tags":["tag1"]}]`,
+		"/1.0/services":           `[{"service":"service1","service_instances":[{"name":"instance1","tags":["tag1"]}]}]`,
+		"/1.0/apps/app1":          `{"name":"app1","platform":"python","units":[{"ID":"u1","Status":"started"}]}`,
+		"/1.0/services/instances": `[]`,
+		"/1.0/apps/app1/quota":    `{"Limit":10,"InUse":1}`,
+	}
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Close {
+			atomic.AddInt64(&s.closes, 1)
+		}
+		w.Write([]byte(responses[r.URL.Path]))
+	}))
+	s.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(&s.conns, 1)
+		}
+	}
+	s.StartTLS()
+	s.target = os.Getenv("TSURU_TARGET")
+	os.Setenv("TSURU_TARGET", s.URL)
+	return s
+}
+
+func (s *apiServer) Close() {
+	s.Server.Close()
+	os.Setenv("TSURU_TARGET", s.target)
+}
+
+// client returns a client trusting the certificate of the server. When
+// keepAlive is false, every request uses a new connection.
+func (s *apiServer) client(keepAlive bool) *cmd.Client {
+	cert, err := x509.ParseCertificate(s.TLS.Certificates[0].Certificate[0])
+	if err != nil {
+		panic(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	config := cmd.DefaultHTTPClientConfig
+	config.TLSConfig = &tls.Config{RootCAs: pool}
+	httpClient := cmd.NewHTTPClient(config)
+	httpClient.Transport.(*http.Transport).DisableKeepAlives = !keepAlive
+	m := cmd.NewManager("glb", "1.0.0", "Supported-Tsuru", ioutil.Discard, ioutil.Discard, os.Stdin, nil)
+	return cmd.NewClient(httpClient, &cmd.Context{Stdout: ioutil.Discard, Stderr: ioutil.Discard}, m)
+}
+
+func (s *S) TestTagListReusesConnections(c *check.C) {
+	server := newAPIServer()
+	defer server.Close()
+	client := server.client(true)
+	for i := 0; i < 5; i++ {
+		context := cmd.Context{Stdout: ioutil.Discard, Stderr: ioutil.Discard}
+		err := (&TagList{}).Run(&context, client)
+		c.Assert(err, check.IsNil)
+	}
+	// tag-list loads apps and services concurrently, using two connections.
+	c.Assert(atomic.LoadInt64(&server.conns) <= 2, check.Equals, true)
+}
+
+func benchmarkTagList(b *testing.B, keepAlive bool) {
+	server := newAPIServer()
+	defer server.Close()
+	client := server.client(keepAlive)
+	context := cmd.Context{Stdout: ioutil.Discard, Stderr: ioutil.Discard}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := (&TagList{}).Run(&context, client); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkTagListKeepAlive(b *testing.B) {
+	benchmarkTagList(b, true)
+}
+
+func BenchmarkTagListNoKeepAlive(b *testing.B) {
+	benchmarkTagList(b, false)
+}
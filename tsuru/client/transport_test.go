@@ -0,0 +1,34 @@
+// Copyright 2017 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"io/ioutil"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/tsuru/tsuru/cmd"
+	"gopkg.in/check.v1"
+)
+
+func (s *S) TestClientDoKeepsConnectionsAlive(c *check.C) {
+	server := newAPIServer()
+	defer server.Close()
+	client := server.client(true)
+	for i := 0; i < 3; i++ {
+		url, err := cmd.GetURL("/apps")
+		c.Assert(err, check.IsNil)
+		request, err := http.NewRequest("GET", url, nil)
+		c.Assert(err, check.IsNil)
+		response, err := client.Do(request)
+		c.Assert(err, check.IsNil)
+		_, err = ioutil.ReadAll(response.Body)
+		c.Assert(err, check.IsNil)
+		response.Body.Close()
+		c.Assert(request.Close, check.Equals, false)
+	}
+	c.Assert(atomic.LoadInt64(&server.closes), check.Equals, int64(0))
+	c.Assert(atomic.LoadInt64(&server.conns), check.Equals, int64(1))
+}
@@ -0,0 +1,180 @@
+// Copyright 2017 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/tsuru/gnuflag"
+	"github.com/tsuru/tsuru/cmd"
+)
+
+const (
+	// appWaitTimeoutCode is the exit status of app-wait when the timeout is
+	// reached before the app is ready.
+	appWaitTimeoutCode = 7
+	// appWaitUnitErrorCode is the exit status of app-wait when units of the
+	// app are in the error status.
+	appWaitUnitErrorCode = 8
+)
+
+// appWaitInitialInterval and appWaitMaxInterval bound the interval between
+// checks of app-wait, which doubles after every unsuccessful check.
+var (
+	appWaitInitialInterval = time.Second
+	appWaitMaxInterval     = 30 * time.Second
+)
+
+type appWaitError struct {
+	code    int
+	message string
+}
+
+func (e *appWaitError) Error() string {
+	return e.message
+}
+
+func (e *appWaitError) ExitCode() int {
+	return e.code
+}
+
+type AppWait struct {
+	cmd.GuessingCommand
+	unitsStarted bool
+	process      string
+	notLocked    bool
+	httpPath     string
+	timeout      time.Duration
+	fs           *gnuflag.FlagSet
+}
+
+func (c *AppWait) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:  "app-wait",
+		Usage: "app-wait [-a/--app appname] [--units-started] [-p/--process processname] [--not-locked] [--http-ok path] [--timeout 10m]",
+		Desc: `Waits for an application to be ready, useful in continuous integration
+pipelines.
+
+The app is ready when all the given conditions are satisfied:
+
+  [[--units-started]] all units of the app, or of the process given by
+  [[--process]], are started. This is the default when no condition is given.
+
+  [[--not-locked]] the app is not locked (see the lock in [[tsuru app-info]]).
+
+  [[--http-ok]] a request to the given path in the address of the app returns
+  a successful status.
+
+The app is checked repeatedly, with an increasing interval between checks,
+until it is ready or the [[--timeout]] is reached.
+
+The command exits with status 0 when the app is ready, 7 when the timeout is
+reached and 8 when units of the app are in the error status.`,
+		MinArgs: 0,
+	}
+}
+
+func (c *AppWait) Flags() *gnuflag.FlagSet {
+	if c.fs == nil {
+		c.fs = c.GuessingCommand.Flags()
+		c.fs.BoolVar(&c.unitsStarted, "units-started", false, "Wait for all units to be started")
+		process := "Only consider the units of the given process"
+		c.fs.StringVar(&c.process, "process", "", process)
+		c.fs.StringVar(&c.process, "p", "", process)
+		c.fs.BoolVar(&c.notLocked, "not-locked", false, "Wait for the app lock to be released")
+		c.fs.StringVar(&c.httpPath, "http-ok", "", "Wait for a request to the given path in the app address to succeed")
+		c.fs.DurationVar(&c.timeout, "timeout", 10*time.Minute, "Maximum time to wait for the app")
+	}
+	return c.fs
+}
+
+func (c *AppWait) Run(context *cmd.Context, client *cmd.Client) error {
+	appName, err := c.Guess()
+	if err != nil {
+		return err
+	}
+	unitsStarted := c.unitsStarted || (!c.notLocked && c.httpPath == "")
+	fmt.Fprintf(context.Stdout, "Waiting for app %q...\n", appName)
+	deadline := time.Now().Add(c.timeout)
+	interval := appWaitInitialInterval
+	for {
+		a, err := loadApp(client, appName)
+		if err != nil {
+			return err
+		}
+		pending, err := c.check(context, a, unitsStarted)
+		if err != nil {
+			renderUnitCounts(context.Stdout, a)
+			return err
+		}
+		if pending == "" {
+			fmt.Fprintf(context.Stdout, "App %q is ready.\n", appName)
+			return nil
+		}
+		if time.Now().Add(interval).After(deadline) {
+			if unitsStarted {
+				renderUnitCounts(context.Stdout, a)
+			}
+			return &appWaitError{
+				code:    appWaitTimeoutCode,
+				message: fmt.Sprintf("timeout after %s waiting for app %q: %s", c.timeout, appName, pending),
+			}
+		}
+		if err = sleep(context, interval); err != nil {
+			return err
+		}
+		if interval *= 2; interval > appWaitMaxInterval {
+			interval = appWaitMaxInterval
+		}
+	}
+}
+
+// check returns the first condition the app doesn't satisfy yet, or an error
+// when units of the app are in the error status.
+func (c *AppWait) check(context *cmd.Context, a *app, unitsStarted bool) (string, error) {
+	if unitsStarted {
+		var units []unit
+		if c.process != "" {
+			units = a.processUnits()[c.process]
+		} else {
+			for _, processUnits := range a.processUnits() {
+				units = append(units, processUnits...)
+			}
+		}
+		var failed []string
+		started := 0
+		for _, u := range units {
+			switch {
+			case u.Status == "error":
+				failed = append(failed, u.ID)
+			case u.Available():
+				started++
+			}
+		}
+		if len(failed) > 0 {
+			return "", &appWaitError{
+				code:    appWaitUnitErrorCode,
+				message: fmt.Sprintf("units of app %q are in the error status: %s", a.Name, strings.Join(failed, ", ")),
+			}
+		}
+		if len(units) == 0 {
+			return "no units", nil
+		}
+		if started < len(units) {
+			return fmt.Sprintf("%d of %d unit(s) started", started, len(units)), nil
+		}
+	}
+	if c.notLocked && a.Lock.Locked {
+		return fmt.Sprintf("app locked by %s: %s", a.Lock.Owner, a.Lock.Reason), nil
+	}
+	if c.httpPath != "" {
+		if err := smokeCheck(context, a.IP, c.httpPath); err != nil {
+			return err.Error(), nil
+		}
+	}
+	return "", nil
+}
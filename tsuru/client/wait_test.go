@@ -0,0 +1,126 @@
+// Copyright 2017 tsuru-client authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package client
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/tsuru/tsuru/cmd"
+	"gopkg.in/check.v1"
+)
+
+// appStatesTransport returns the given app states in sequence, repeating the
+// last one.
+type appStatesTransport struct {
+	states []string
+	calls  int
+}
+
+func (t *appStatesTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	i := t.calls
+	if i >= len(t.states) {
+		i = len(t.states) - 1
+	}
+	t.calls++
+	return &http.Response{
+		Body:       ioutil.NopCloser(strings.NewReader(t.states[i])),
+		StatusCode: http.StatusOK,
+	}, nil
+}
+
+func (s *S) TestAppWaitInfo(c *check.C) {
+	c.Assert((&AppWait{}).Info(), check.NotNil)
+}
+
+func (s *S) TestAppWaitUnitsStarted(c *check.C) {
+	defer func(d time.Duration) { appWaitInitialInterval = d }(appWaitInitialInterval)
+	appWaitInitialInterval = time.Millisecond
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &appStatesTransport{states: []string{
+		`{"name":"myapp","units":[{"ID":"u1","Status":"building","ProcessName":"web"}]}`,
+		`{"name":"myapp","units":[{"ID":"u1","Status":"started","ProcessName":"web"},{"ID":"u2","Status":"starting","ProcessName":"worker"}]}`,
+	}}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppWait{}
+	command.Flags().Parse(true, []string{"-a", "myapp", "--units-started", "-p", "web"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(trans.calls, check.Equals, 2)
+	c.Assert(stdout.String(), check.Equals, "Waiting for app \"myapp\"...\nApp \"myapp\" is ready.\n")
+}
+
+func (s *S) TestAppWaitTimeout(c *check.C) {
+	defer func(d time.Duration) { appWaitInitialInterval = d }(appWaitInitialInterval)
+	appWaitInitialInterval = time.Millisecond
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &appStatesTransport{states: []string{
+		`{"name":"myapp","units":[{"ID":"u1","Status":"started","ProcessName":"web"},{"ID":"u2","Status":"starting","ProcessName":"web"}]}`,
+	}}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppWait{}
+	command.Flags().Parse(true, []string{"-a", "myapp", "--timeout", "10ms"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.ErrorMatches, `timeout after 10ms waiting for app "myapp": 1 of 2 unit\(s\) started`)
+	c.Assert(err.(cmd.ExitCoder).ExitCode(), check.Equals, 7)
+	c.Assert(stdout.String(), check.Matches, `(?s).*\| web +\| 2 +\| 1 started, 1 starting \|.*`)
+}
+
+func (s *S) TestAppWaitErrorUnits(c *check.C) {
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &appStatesTransport{states: []string{
+		`{"name":"myapp","units":[{"ID":"u1","Status":"started","ProcessName":"web"},{"ID":"u2","Status":"error","ProcessName":"web"}]}`,
+	}}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppWait{}
+	command.Flags().Parse(true, []string{"-a", "myapp"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.ErrorMatches, `units of app "myapp" are in the error status: u2`)
+	c.Assert(err.(cmd.ExitCoder).ExitCode(), check.Equals, 8)
+	c.Assert(trans.calls, check.Equals, 1)
+}
+
+func (s *S) TestAppWaitNotLockedAndHTTPOk(c *check.C) {
+	defer func(d time.Duration) { appWaitInitialInterval = d }(appWaitInitialInterval)
+	appWaitInitialInterval = time.Millisecond
+	var requested string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.Path
+	}))
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "http://")
+	var stdout, stderr bytes.Buffer
+	context := cmd.Context{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	}
+	trans := &appStatesTransport{states: []string{
+		`{"name":"myapp","ip":"` + address + `","lock":{"Locked":true,"Owner":"admin","Reason":"POST /apps/myapp/deploy"}}`,
+		`{"name":"myapp","ip":"` + address + `","lock":{"Locked":false}}`,
+	}}
+	client := cmd.NewClient(&http.Client{Transport: trans}, nil, manager)
+	command := AppWait{}
+	command.Flags().Parse(true, []string{"-a", "myapp", "--not-locked", "--http-ok", "/healthcheck"})
+	err := command.Run(&context, client)
+	c.Assert(err, check.IsNil)
+	c.Assert(trans.calls, check.Equals, 2)
+	c.Assert(requested, check.Equals, "/healthcheck")
+}
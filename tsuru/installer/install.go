@@ -145,7 +145,7 @@ func parseConfigFile(file string) (*InstallOpts, error) {
 }
 
 func addInstallHosts(machines []*dockermachine.Machine, client *cmd.Client) error {
-	path, err := cmd.GetURLVersion("1.2", "/install/hosts")
+	path, err := client.URLVersion("/install/hosts", "1.2")
 	if err != nil {
 		return err
 	}
@@ -362,7 +362,7 @@ func (c *InstallHostList) Run(context *cmd.Context, cli *cmd.Client) error {
 }
 
 func listHosts(context *cmd.Context, cli *cmd.Client) ([]installHost, error) {
-	url, err := cmd.GetURLVersion("1.2", "/install/hosts")
+	url, err := cli.URLVersion("/install/hosts", "1.2")
 	if err != nil {
 		return nil, err
 	}
@@ -434,7 +434,7 @@ func (c *InstallSSH) Flags() *gnuflag.FlagSet {
 
 func (c *InstallSSH) Run(context *cmd.Context, cli *cmd.Client) error {
 	hostName := context.Args[0]
-	url, err := cmd.GetURLVersion("1.2", "/install/hosts/"+hostName)
+	url, err := cli.URLVersion("/install/hosts/"+hostName, "1.2")
 	if err != nil {
 		return err
 	}
@@ -41,9 +41,11 @@ func (s *S) SetUpSuite(c *check.C) {
 	var stdout, stderr bytes.Buffer
 	manager = cmd.NewManager("glb", "1.0.0", "Supported-Tsuru-Version", &stdout, &stderr, os.Stdin, nil)
 	swarmPort = 0
+	os.Setenv("TSURU_API_VERSION", "1.3")
 }
 
 func (s *S) TearDownSuite(c *check.C) {
+	os.Unsetenv("TSURU_API_VERSION")
 	err := os.RemoveAll(s.tmpDir)
 	c.Assert(err, check.IsNil)
 }
@@ -30,12 +30,16 @@ func buildManager(name string) *cmd.Manager {
 	m.Register(&client.AppRun{})
 	m.Register(&client.AppInfo{})
 	m.Register(&client.AppCreate{})
+	m.Register(&client.AppClone{})
 	m.Register(&client.AppRemove{})
 	m.Register(&client.AppUpdate{})
 	m.Register(&client.UnitAdd{})
 	m.Register(&client.UnitRemove{})
+	m.Register(&client.UnitSet{})
+	m.Register(&client.AppWait{})
 	m.Register(&client.AppList{})
 	m.Register(&client.AppLog{})
+	m.Register(&client.AppHistory{})
 	m.Register(&client.AppGrant{})
 	m.Register(&client.AppRevoke{})
 	m.Register(&client.AppRestart{})
@@ -50,6 +54,8 @@ func buildManager(name string) *cmd.Manager {
 	m.Register(&client.EnvGet{})
 	m.Register(&client.EnvSet{})
 	m.Register(&client.EnvUnset{})
+	m.Register(&client.EnvEncrypt{})
+	m.Register(&client.EnvDecrypt{})
 	m.Register(&client.KeyAdd{})
 	m.Register(&client.KeyRemove{})
 	m.Register(&client.KeyList{})
@@ -73,6 +79,7 @@ func buildManager(name string) *cmd.Manager {
 	m.Register(&client.PluginList{})
 	m.Register(&client.AppSwap{})
 	m.Register(&client.AppDeploy{})
+	m.Register(&client.AppDeployBlueGreen{})
 	m.Register(&client.PlanList{})
 	m.Register(&client.UserCreate{})
 	m.Register(&client.ResetPassword{})
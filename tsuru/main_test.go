@@ -6,9 +6,26 @@ package main
 
 import (
 	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"gopkg.in/check.v1"
 
@@ -17,6 +34,7 @@ import (
 	"github.com/tsuru/tsuru-client/tsuru/installer"
 	"github.com/tsuru/tsuru/cmd"
 	"github.com/tsuru/tsuru/exec/exectest"
+	"golang.org/x/net/websocket"
 )
 
 type S struct{}
@@ -58,6 +76,13 @@ func (s *S) TestAppCreateIsRegistered(c *check.C) {
 	c.Assert(create, check.FitsTypeOf, &client.AppCreate{})
 }
 
+func (s *S) TestAppCloneIsRegistered(c *check.C) {
+	manager = buildManager("tsuru")
+	clone, ok := manager.Commands["app-clone"]
+	c.Assert(ok, check.Equals, true)
+	c.Assert(clone, check.FitsTypeOf, &client.AppClone{})
+}
+
 func (s *S) TestAppRemoveIsRegistered(c *check.C) {
 	manager = buildManager("tsuru")
 	remove, ok := manager.Commands["app-remove"]
@@ -93,6 +118,13 @@ func (s *S) TestAppLogIsRegistered(c *check.C) {
 	c.Assert(log, check.FitsTypeOf, &client.AppLog{})
 }
 
+func (s *S) TestAppHistoryIsRegistered(c *check.C) {
+	manager = buildManager("tsuru")
+	history, ok := manager.Commands["app-history"]
+	c.Assert(ok, check.Equals, true)
+	c.Assert(history, check.FitsTypeOf, &client.AppHistory{})
+}
+
 func (s *S) TestAppRunIsRegistered(c *check.C) {
 	manager = buildManager("tsuru")
 	run, ok := manager.Commands["app-run"]
@@ -121,6 +153,20 @@ func (s *S) TestEnvSetIsRegistered(c *check.C) {
 	c.Assert(set, check.FitsTypeOf, &client.EnvSet{})
 }
 
+func (s *S) TestEnvEncryptIsRegistered(c *check.C) {
+	manager = buildManager("tsuru")
+	encrypt, ok := manager.Commands["env-encrypt"]
+	c.Assert(ok, check.Equals, true)
+	c.Assert(encrypt, check.FitsTypeOf, &client.EnvEncrypt{})
+}
+
+func (s *S) TestEnvDecryptIsRegistered(c *check.C) {
+	manager = buildManager("tsuru")
+	decrypt, ok := manager.Commands["env-decrypt"]
+	c.Assert(ok, check.Equals, true)
+	c.Assert(decrypt, check.FitsTypeOf, &client.EnvDecrypt{})
+}
+
 func (s *S) TestEnvUnsetIsRegistered(c *check.C) {
 	manager = buildManager("tsuru")
 	unset, ok := manager.Commands["env-unset"]
@@ -233,6 +279,20 @@ func (s *S) TestUnitAddIsRegistered(c *check.C) {
 	c.Assert(addunit, check.FitsTypeOf, &client.UnitAdd{})
 }
 
+func (s *S) TestUnitSetIsRegistered(c *check.C) {
+	manager = buildManager("tsuru")
+	unitSet, ok := manager.Commands["unit-set"]
+	c.Assert(ok, check.Equals, true)
+	c.Assert(unitSet, check.FitsTypeOf, &client.UnitSet{})
+}
+
+func (s *S) TestAppWaitIsRegistered(c *check.C) {
+	manager = buildManager("tsuru")
+	wait, ok := manager.Commands["app-wait"]
+	c.Assert(ok, check.Equals, true)
+	c.Assert(wait, check.FitsTypeOf, &client.AppWait{})
+}
+
 func (s *S) TestUnitRemoveIsRegistered(c *check.C) {
 	manager = buildManager("tsuru")
 	rmunit, ok := manager.Commands["unit-remove"]
@@ -319,6 +379,43 @@ func (s *S) TestPluginLookup(c *check.C) {
 	c.Assert(fexec.ExecutedCmd(pluginPath, []string{}), check.Equals, true)
 }
 
+func (s *S) TestPluginLookupTokenFileIsPerRun(c *check.C) {
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	tempHome, _ := filepath.Abs("client/testdata")
+	os.Setenv("HOME", tempHome)
+	defer os.Setenv("TSURU_TOKEN", os.Getenv("TSURU_TOKEN"))
+	os.Setenv("TSURU_TOKEN", "env-token")
+	tokenPath := filepath.Join(c.MkDir(), "token")
+	err := ioutil.WriteFile(tokenPath, []byte("file-token\n"), 0600)
+	c.Assert(err, check.IsNil)
+	fexec := exectest.FakeExecutor{}
+	client.Execut = &fexec
+	defer func() {
+		client.Execut = nil
+	}()
+	manager = buildManager("tsuru")
+	manager.Run([]string{"--token-file", tokenPath, "myplugin"})
+	manager = buildManager("tsuru")
+	manager.Run([]string{"myplugin"})
+	pluginPath := cmd.JoinWithUserDir(".tsuru", "plugins", "myplugin")
+	cmds := fexec.GetCommands(pluginPath)
+	c.Assert(cmds, check.HasLen, 2)
+	c.Assert(pluginToken(cmds[0].GetEnvs()), check.Equals, "file-token")
+	c.Assert(pluginToken(cmds[1].GetEnvs()), check.Equals, "env-token")
+}
+
+// pluginToken returns the token given to a plugin, the last TSURU_TOKEN in its
+// environment.
+func pluginToken(envs []string) string {
+	var token string
+	for _, env := range envs {
+		if strings.HasPrefix(env, "TSURU_TOKEN=") {
+			token = strings.TrimPrefix(env, "TSURU_TOKEN=")
+		}
+	}
+	return token
+}
+
 func (s *S) TestAppStopIsRegistered(c *check.C) {
 	manager = buildManager("tsuru")
 	stop, ok := manager.Commands["app-stop"]
@@ -333,6 +430,13 @@ func (s *S) TestAppDeployIsRegistered(c *check.C) {
 	c.Assert(deployCmd, check.FitsTypeOf, &client.AppDeploy{})
 }
 
+func (s *S) TestAppDeployBlueGreenIsRegistered(c *check.C) {
+	manager = buildManager("tsuru")
+	deployCmd, ok := manager.Commands["app-deploy-bluegreen"]
+	c.Assert(ok, check.Equals, true)
+	c.Assert(deployCmd, check.FitsTypeOf, &client.AppDeployBlueGreen{})
+}
+
 func (s *S) TestPlanListRegistered(c *check.C) {
 	manager = buildManager("tsuru")
 	list, ok := manager.Commands["plan-list"]
@@ -538,3 +642,555 @@ func (s *S) TestServiceTemplateIsRegistered(c *check.C) {
 	c.Assert(ok, check.Equals, true)
 	c.Assert(list, check.FitsTypeOf, &admin.ServiceTemplate{})
 }
+
+// TestManagerHelper runs the manager when the test binary is executed by
+// runManager, so tests can check the exit status of commands.
+func TestManagerHelper(t *testing.T) {
+	args := os.Getenv("TSURU_TEST_MANAGER_ARGS")
+	if args == "" {
+		return
+	}
+	buildManager("tsuru").Run(strings.Split(args, " "))
+}
+
+// managerCommand returns the process that runs the manager with the given
+// args.
+func managerCommand(target string, args ...string) *exec.Cmd {
+	proc := exec.Command(os.Args[0], "-test.run=^TestManagerHelper$")
+	proc.Env = append(os.Environ(),
+		"TSURU_TEST_MANAGER_ARGS="+strings.Join(args, " "),
+		"TSURU_TARGET="+target,
+		"TSURU_MAX_RETRIES=0",
+	)
+	return proc
+}
+
+func exitCode(c *check.C, err error) int {
+	if err == nil {
+		return 0
+	}
+	exitErr, ok := err.(*exec.ExitError)
+	c.Assert(ok, check.Equals, true, check.Commentf("%v", err))
+	return exitErr.ExitCode()
+}
+
+// runManager runs the manager with the given args in a new process, returning
+// its exit status and standard error.
+func runManager(c *check.C, target string, args ...string) (int, string) {
+	proc := managerCommand(target, args...)
+	var stderr bytes.Buffer
+	proc.Stderr = &stderr
+	err := proc.Run()
+	return exitCode(c, err), stderr.String()
+}
+
+func (s *S) TestExitCodes(c *check.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/1.0/teams":
+			http.Error(w, "You don't have permission to list teams.", http.StatusForbidden)
+		case "/1.0/pools":
+			http.Error(w, "Pool already exists.", http.StatusConflict)
+		default:
+			http.Error(w, "App myapp not found.", http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	closed := httptest.NewServer(http.NotFoundHandler())
+	closed.Close()
+	tests := []struct {
+		target string
+		args   []string
+		status int
+		stderr string
+	}{
+		{server.URL, []string{"app-info", "-a", "myapp"}, 3, "Error: App myapp not found.\n"},
+		{server.URL, []string{"team-list"}, 4, "Error: You don't have permission to list teams.\n"},
+		{server.URL, []string{"pool-add", "mypool"}, 5, "Error: Pool already exists.\n"},
+		{closed.URL, []string{"team-list"}, 6, "Error: Failed to connect to tsuru server (" + closed.URL + "), it's probably down.\n"},
+		{server.URL, []string{"--error-format", "xml", "team-list"}, 2, "invalid error format \"xml\", expected text or json\n"},
+	}
+	for _, t := range tests {
+		status, stderr := runManager(c, t.target, t.args...)
+		c.Check(status, check.Equals, t.status, check.Commentf("%v", t.args))
+		c.Check(stderr, check.Equals, t.stderr, check.Commentf("%v", t.args))
+	}
+}
+
+func (s *S) TestExitCodeTimeout(c *check.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(500 * time.Millisecond)
+	}))
+	defer server.Close()
+	defer os.Unsetenv("TSURU_HTTP_TIMEOUT")
+	os.Setenv("TSURU_HTTP_TIMEOUT", "50ms")
+	status, stderr := runManager(c, server.URL, "team-list")
+	c.Assert(status, check.Equals, 7)
+	c.Assert(stderr, check.Equals, "Error: Timeout waiting for the tsuru server ("+server.URL+").\n")
+}
+
+func (s *S) TestErrorFormatJSON(c *check.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "App myapp not found.", http.StatusNotFound)
+	}))
+	defer server.Close()
+	status, stderr := runManager(c, server.URL, "--error-format", "json", "app-info", "-a", "myapp")
+	c.Assert(status, check.Equals, 3)
+	c.Assert(stderr, check.Equals, `{"code":3,"http_status":404,"message":"App myapp not found.","command":"app-info"}`+"\n")
+	status, stderr = runManager(c, server.URL, "--error-format", "json", "app-inf")
+	c.Assert(status, check.Equals, 1)
+	c.Assert(stderr, check.Matches, `\{"code":1,"message":"tsuru: \\"app-inf\\" is not a tsuru command\..*","command":"app-inf"\}\n`)
+}
+
+func (s *S) TestExitCodeUsage(c *check.C) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	status, stderr := runManager(c, server.URL, "app-info", "--unknown")
+	c.Assert(status, check.Equals, 2)
+	c.Assert(stderr, check.Matches, `(?s)flag provided but not defined: --unknown\n.*flag provided but not defined: --unknown\n`)
+	status, _ = runManager(c, server.URL, "app-create")
+	c.Assert(status, check.Equals, 2)
+	status, stderr = runManager(c, server.URL, "--unknown", "team-list")
+	c.Assert(status, check.Equals, 2)
+	c.Assert(stderr, check.Matches, `(?s)flag provided but not defined: --unknown\nUsage of tsuru flags:\n.*`)
+}
+
+func (s *S) TestErrorFormatJSONUsage(c *check.C) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	status, stderr := runManager(c, server.URL, "--error-format", "json", "app-info", "--unknown")
+	c.Assert(status, check.Equals, 2)
+	c.Assert(stderr, check.Equals, `{"code":2,"message":"flag provided but not defined: --unknown","command":"app-info"}`+"\n")
+	status, stderr = runManager(c, server.URL, "--error-format", "json", "app-create")
+	c.Assert(status, check.Equals, 2)
+	c.Assert(stderr, check.Equals, `{"code":2,"message":"wrong number of arguments.","command":"app-create"}`+"\n")
+	status, stderr = runManager(c, server.URL, "--error-format", "json", "--unknown", "team-list")
+	c.Assert(status, check.Equals, 2)
+	c.Assert(stderr, check.Equals, `{"code":2,"message":"flag provided but not defined: --unknown"}`+"\n")
+}
+
+// newTLSServer starts a tsuru API signed by a private authority that requires
+// client certificates signed by the same authority, writing the certificate
+// of the authority and a client certificate to dir.
+func newTLSServer(c *check.C, dir string) *httptest.Server {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	c.Assert(err, check.IsNil)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "tsuru test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	c.Assert(err, check.IsNil)
+	caCert, err := x509.ParseCertificate(caDER)
+	c.Assert(err, check.IsNil)
+	issue := func(serial int64, usage x509.ExtKeyUsage) tls.Certificate {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		c.Assert(err, check.IsNil)
+		template := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "localhost"},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, template, caCert, &key.PublicKey, caKey)
+		c.Assert(err, check.IsNil)
+		return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+	}
+	writePEM := func(name, kind string, data []byte) {
+		err := ioutil.WriteFile(filepath.Join(dir, name), pem.EncodeToMemory(&pem.Block{Type: kind, Bytes: data}), 0600)
+		c.Assert(err, check.IsNil)
+	}
+	writePEM("ca.pem", "CERTIFICATE", caDER)
+	client := issue(3, x509.ExtKeyUsageClientAuth)
+	writePEM("client.pem", "CERTIFICATE", client.Certificate[0])
+	keyDER, err := x509.MarshalECPrivateKey(client.PrivateKey.(*ecdsa.PrivateKey))
+	c.Assert(err, check.IsNil)
+	writePEM("client-key.pem", "EC PRIVATE KEY", keyDER)
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[]"))
+	}))
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.TLS = &tls.Config{
+		Certificates: []tls.Certificate{issue(2, x509.ExtKeyUsageServerAuth)},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}
+	server.StartTLS()
+	return server
+}
+
+func (s *S) TestTargetTLS(c *check.C) {
+	home := c.MkDir()
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", home)
+	server := newTLSServer(c, home)
+	defer server.Close()
+	status, stderr := runManager(c, server.URL, "target-add", "secure", server.URL, "-s")
+	c.Assert(status, check.Equals, 0, check.Commentf(stderr))
+	status, stderr = runManager(c, server.URL, "team-list")
+	c.Assert(status, check.Equals, 1)
+	c.Assert(stderr, check.Matches, `Error: Failed to connect to tsuru server \(`+server.URL+`\), if the server uses a private certificate authority, trust it with target-add --ca-cert: .*\n`)
+	status, _ = runManager(c, server.URL, "target-remove", "secure")
+	c.Assert(status, check.Equals, 0)
+	status, stderr = runManager(c, server.URL, "target-add", "secure", server.URL, "-s", "--ca-cert", filepath.Join(home, "ca.pem"))
+	c.Assert(status, check.Equals, 0, check.Commentf(stderr))
+	status, stderr = runManager(c, server.URL, "team-list")
+	c.Assert(status, check.Equals, 1)
+	c.Assert(stderr, check.Matches, `Error: Failed to connect to tsuru server \(`+server.URL+`\), if the server requires a client certificate, set it with target-add --client-cert and --client-key: .*\n`)
+	status, _ = runManager(c, server.URL, "target-remove", "secure")
+	c.Assert(status, check.Equals, 0)
+	status, stderr = runManager(c, server.URL, "target-add", "secure", server.URL, "-s",
+		"--ca-cert", filepath.Join(home, "ca.pem"),
+		"--client-cert", filepath.Join(home, "client.pem"),
+		"--client-key", filepath.Join(home, "client-key.pem"))
+	c.Assert(status, check.Equals, 0, check.Commentf(stderr))
+	status, stderr = runManager(c, server.URL, "team-list")
+	c.Assert(status, check.Equals, 0, check.Commentf(stderr))
+	c.Assert(stderr, check.Equals, "")
+	status, _ = runManager(c, server.URL, "target-remove", "secure")
+	c.Assert(status, check.Equals, 0)
+	status, stderr = runManager(c, server.URL, "target-add", "secure", server.URL, "-s", "--insecure-skip-verify")
+	c.Assert(status, check.Equals, 0, check.Commentf(stderr))
+	c.Assert(stderr, check.Matches, `WARNING: TLS certificate verification is disabled for the target "secure"(?s).*`)
+	status, stderr = runManager(c, server.URL, "team-list")
+	c.Assert(status, check.Equals, 1)
+	c.Assert(stderr, check.Matches, `WARNING: TLS certificate verification is disabled for the target "secure"(?s).*client certificate.*`)
+	status, _ = runManager(c, server.URL, "target-remove", "secure")
+	c.Assert(status, check.Equals, 0)
+	_, err := os.Stat(filepath.Join(home, ".tsuru", "tls.d", "secure"))
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+}
+
+func (s *S) TestTargetTLSInvalidSettings(c *check.C) {
+	home := c.MkDir()
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", home)
+	tests := []struct {
+		args   []string
+		stderr string
+	}{
+		{[]string{"--client-cert", "client.pem"}, "Error: the client certificate and key must be provided together\n"},
+		{[]string{"--ca-cert", filepath.Join(home, "missing.pem")}, "Error: unable to read the CA bundle: open .*missing.pem: no such file or directory\n"},
+		{[]string{"--ca-cert", "/etc/hostname"}, "Error: no certificates found in the CA bundle /etc/hostname\n"},
+	}
+	for _, t := range tests {
+		args := append([]string{"target-add", "secure", "https://tsuru.example.com"}, t.args...)
+		status, stderr := runManager(c, "", args...)
+		c.Check(status, check.Equals, 1, check.Commentf("%v", t.args))
+		c.Check(stderr, check.Matches, t.stderr, check.Commentf("%v", t.args))
+	}
+	_, err := os.Stat(filepath.Join(home, ".tsuru", "targets"))
+	c.Assert(os.IsNotExist(err), check.Equals, true)
+	status, stderr := runManager(c, "", "target-add", "secure", "https://tsuru.example.com", "-s")
+	c.Assert(status, check.Equals, 0, check.Commentf(stderr))
+	err = os.MkdirAll(filepath.Join(home, ".tsuru", "tls.d"), 0700)
+	c.Assert(err, check.IsNil)
+	err = ioutil.WriteFile(filepath.Join(home, ".tsuru", "tls.d", "secure"), []byte(`{"CACert":"/missing.pem"}`), 0600)
+	c.Assert(err, check.IsNil)
+	status, stderr = runManager(c, "", "team-list")
+	c.Assert(status, check.Equals, 1)
+	c.Assert(stderr, check.Matches, `Error: invalid TLS settings for the target "secure": unable to read the CA bundle: .*\n`)
+}
+
+// hangingServer is a tsuru API that doesn't report its version and holds the
+// other requests until they're canceled, after writing a log message. Requests are sent to the returned channel.
+func hangingServer() (*httptest.Server, chan string) {
+	requests := make(chan string, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/1.0/info" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`[{"Message":"starting"}]` + "\n"))
+		w.(http.Flusher).Flush()
+		requests <- r.Method + " " + r.URL.Path
+		<-r.Context().Done()
+	}))
+	return server, requests
+}
+
+func (s *S) TestTimeoutFlag(c *check.C) {
+	server, requests := hangingServer()
+	defer server.Close()
+	status, stderr := runManager(c, server.URL, "--timeout", "200ms", "team-list")
+	c.Assert(status, check.Equals, 7)
+	c.Assert(stderr, check.Equals, "Error: the command didn't finish in 200ms, the duration set by --timeout.\n")
+	c.Assert(<-requests, check.Equals, "GET /1.0/teams")
+	status, stderr = runManager(c, server.URL, "--timeout", "200ms", "app-log", "-a", "myapp", "-f")
+	c.Assert(status, check.Equals, 7, check.Commentf(stderr))
+	c.Assert(stderr, check.Equals, "Error: the command didn't finish in 200ms, the duration set by --timeout.\n")
+	status, stderr = runManager(c, server.URL, "--timeout", "200ms", "app-wait", "-a", "myapp", "--timeout", "10m")
+	c.Assert(status, check.Equals, 7, check.Commentf(stderr))
+	c.Assert(stderr, check.Equals, "Error: the command didn't finish in 200ms, the duration set by --timeout.\n")
+	status, stderr = runManager(c, server.URL, "--timeout", "soon", "team-list")
+	c.Assert(status, check.Equals, 2)
+	c.Assert(stderr, check.Matches, `(?s)invalid value "soon" for flag --timeout: time: invalid duration "?soon"?\nUsage of tsuru flags:\n.*`)
+}
+
+func (s *S) TestTimeoutFlagIdempotentRequest(c *check.C) {
+	requests := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/1.0/info" {
+			http.NotFound(w, r)
+			return
+		}
+		requests <- r.Method + " " + r.URL.Path
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+	status, stderr := runManager(c, server.URL, "--timeout", "200ms", "app-grant", "admin", "-a", "myapp")
+	c.Assert(status, check.Equals, 7, check.Commentf(stderr))
+	c.Assert(stderr, check.Equals, "Error: the command didn't finish in 200ms, the duration set by --timeout.\n")
+	c.Assert(<-requests, check.Equals, "PUT /1.0/apps/myapp/teams/admin")
+}
+
+func (s *S) TestTimeoutFlagAppAddress(c *check.C) {
+	requests := make(chan string, 1)
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests <- r.Method + " " + r.URL.Path
+		<-r.Context().Done()
+	}))
+	defer app.Close()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/1.0/apps/myapp" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(`{"name":"myapp","ip":"` + app.URL + `"}`))
+	}))
+	defer server.Close()
+	status, stderr := runManager(c, server.URL, "--timeout", "200ms", "app-wait", "-a", "myapp", "--http-ok", "/health", "--timeout", "10m")
+	c.Assert(status, check.Equals, 7, check.Commentf(stderr))
+	c.Assert(stderr, check.Equals, "Error: the command didn't finish in 200ms, the duration set by --timeout.\n")
+	c.Assert(<-requests, check.Equals, "GET /health")
+}
+
+func (s *S) TestInterrupt(c *check.C) {
+	server, requests := hangingServer()
+	defer server.Close()
+	proc := managerCommand(server.URL, "app-log", "-a", "myapp", "-f")
+	var stderr bytes.Buffer
+	proc.Stderr = &stderr
+	err := proc.Start()
+	c.Assert(err, check.IsNil)
+	select {
+	case <-requests:
+	case <-time.After(5 * time.Second):
+		proc.Process.Kill()
+		c.Fatal("timed out waiting for the request")
+	}
+	err = proc.Process.Signal(os.Interrupt)
+	c.Assert(err, check.IsNil)
+	c.Assert(exitCode(c, proc.Wait()), check.Equals, 130)
+	c.Assert(stderr.String(), check.Matches, `(?s)
+Interrupted, canceling the requests in flight:
+  GET /1.0/apps/myapp/log\?.*
+Press Ctrl-C again to exit immediately.
+Error: interrupted.
+`)
+}
+
+func (s *S) TestVerboseUnsafeWarning(c *check.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+	status, stderr := runManager(c, server.URL, "-v", "1", "--verbose-unsafe", "team-list")
+	c.Assert(status, check.Equals, 0)
+	c.Assert(stderr, check.Matches, `WARNING: --verbose-unsafe disables the redaction of secrets in the HTTP dumps,(?s).*`)
+	status, stderr = runManager(c, server.URL, "-v", "1", "team-list")
+	c.Assert(status, check.Equals, 0)
+	c.Assert(stderr, check.Equals, "")
+}
+
+func readHAR(c *check.C, path string) map[string]interface{} {
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, check.IsNil)
+	var har struct {
+		Log map[string]interface{} `json:"log"`
+	}
+	err = json.Unmarshal(data, &har)
+	c.Assert(err, check.IsNil)
+	return har.Log
+}
+
+func (s *S) TestTraceFile(c *check.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/1.0/apps/myapp/env":
+			w.Header().Set("Content-Type", "application/x-json-stream")
+			w.Write([]byte(`{"Message":"variables set"}` + "\n"))
+		case "/1.0/apps/myapp/log":
+			w.Header().Set("Content-Type", "application/x-json-stream")
+			for i := 0; i < 3; i++ {
+				w.Write([]byte(`[{"Message":"line"}]` + "\n"))
+				w.(http.Flusher).Flush()
+			}
+		}
+	}))
+	defer server.Close()
+	path := filepath.Join(c.MkDir(), "trace.har")
+	status, stderr := runManager(c, server.URL, "--trace-file", path, "env-set", "-a", "myapp", "-p", "DB_PASSWORD=s3cr3t")
+	c.Assert(status, check.Equals, 0, check.Commentf(stderr))
+	har := readHAR(c, path)
+	c.Assert(har["version"], check.Equals, "1.2")
+	c.Assert(har["creator"].(map[string]interface{})["name"], check.Equals, "tsuru")
+	entries := har["entries"].([]interface{})
+	c.Assert(entries, check.HasLen, 1)
+	env := entries[0].(map[string]interface{})
+	request := env["request"].(map[string]interface{})
+	c.Assert(request["method"], check.Equals, "POST")
+	c.Assert(request["url"], check.Equals, server.URL+"/1.0/apps/myapp/env")
+	c.Assert(request["headers"], check.DeepEquals, []interface{}{
+		map[string]interface{}{"name": "Authorization", "value": "bearer REDACTED"},
+		map[string]interface{}{"name": "Content-Type", "value": "application/x-www-form-urlencoded"},
+	})
+	postData := request["postData"].(map[string]interface{})
+	c.Assert(postData["text"], check.Matches, `.*Envs.0.Value=REDACTED.*`)
+	response := env["response"].(map[string]interface{})
+	c.Assert(response["status"], check.Equals, 200.0)
+	c.Assert(response["content"].(map[string]interface{})["text"], check.Equals, `{"Message":"variables set"}`+"\n")
+	timings := env["timings"].(map[string]interface{})
+	c.Assert(timings["wait"].(float64) >= 0, check.Equals, true)
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, check.IsNil)
+	c.Assert(strings.Contains(string(data), "s3cr3t"), check.Equals, false)
+	c.Assert(strings.Contains(string(data), "sometoken"), check.Equals, false)
+	status, stderr = runManager(c, server.URL, "--trace-file", path, "app-log", "-a", "myapp", "-f")
+	c.Assert(status, check.Equals, 0, check.Commentf(stderr))
+	entries = readHAR(c, path)["entries"].([]interface{})
+	c.Assert(entries, check.HasLen, 1)
+	content := entries[0].(map[string]interface{})["response"].(map[string]interface{})["content"].(map[string]interface{})
+	c.Assert(content["size"], check.Equals, 63.0)
+	c.Assert(content["comment"], check.Matches, `streaming response, 63 bytes received in .*`)
+}
+
+func (s *S) TestTraceFileInterrupted(c *check.C) {
+	server, requests := hangingServer()
+	defer server.Close()
+	path := filepath.Join(c.MkDir(), "trace.har")
+	proc := managerCommand(server.URL, "--trace-file", path, "app-log", "-a", "myapp", "-f")
+	err := proc.Start()
+	c.Assert(err, check.IsNil)
+	select {
+	case <-requests:
+	case <-time.After(5 * time.Second):
+		proc.Process.Kill()
+		c.Fatal("timed out waiting for the request")
+	}
+	err = proc.Process.Signal(os.Interrupt)
+	c.Assert(err, check.IsNil)
+	err = proc.Process.Signal(os.Interrupt)
+	c.Assert(err, check.IsNil)
+	c.Assert(exitCode(c, proc.Wait()), check.Equals, 130)
+	entries := readHAR(c, path)["entries"].([]interface{})
+	c.Assert(entries, check.HasLen, 1)
+	request := entries[0].(map[string]interface{})["request"].(map[string]interface{})
+	c.Assert(request["url"], check.Matches, server.URL+`/1.0/apps/myapp/log\?.*`)
+}
+
+func (s *S) TestTraceFileShell(c *check.C) {
+	mux := http.NewServeMux()
+	mux.Handle("/1.0/apps/myapp/shell", websocket.Handler(func(conn *websocket.Conn) {
+		conn.Write([]byte("bye\n"))
+		conn.Close()
+	}))
+	mux.HandleFunc("/1.0/apps/myapp", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"myapp"}`))
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	path := filepath.Join(c.MkDir(), "trace.har")
+	status, stderr := runManager(c, server.URL, "--trace-file", path, "app-shell", "-a", "myapp")
+	c.Assert(status, check.Equals, 0, check.Commentf(stderr))
+	entries := readHAR(c, path)["entries"].([]interface{})
+	c.Assert(entries, check.HasLen, 2)
+	shell := entries[1].(map[string]interface{})
+	request := shell["request"].(map[string]interface{})
+	c.Assert(request["method"], check.Equals, "GET")
+	c.Assert(request["url"], check.Matches, "ws"+strings.TrimPrefix(server.URL, "http")+`/1.0/apps/myapp/shell\?.*`)
+	c.Assert(request["headers"], check.DeepEquals, []interface{}{
+		map[string]interface{}{"name": "Authorization", "value": "bearer REDACTED"},
+	})
+	response := shell["response"].(map[string]interface{})
+	c.Assert(response["status"], check.Equals, 101.0)
+}
+
+func (s *S) TestTraceFileLogin(c *check.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"name":"oauth","data":{"authorizeUrl":"http://auth.example.com"}}`))
+	}))
+	defer server.Close()
+	path := filepath.Join(c.MkDir(), "trace.har")
+	status, _ := runManager(c, server.URL, "--trace-file", path, "login", "--no-browser")
+	c.Assert(status, check.Equals, 1)
+	entries := readHAR(c, path)["entries"].([]interface{})
+	c.Assert(entries, check.HasLen, 1)
+	request := entries[0].(map[string]interface{})["request"].(map[string]interface{})
+	c.Assert(request["url"], check.Equals, server.URL+"/1.0/auth/scheme")
+}
+
+func (s *S) TestProjectFile(c *check.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", c.MkDir())
+	dir := c.MkDir()
+	run := func(project string, args ...string) (int, string) {
+		err := ioutil.WriteFile(filepath.Join(dir, ".tsuru.yaml"), []byte(project), 0600)
+		c.Assert(err, check.IsNil)
+		proc := managerCommand("", args...)
+		proc.Dir = dir
+		var stderr bytes.Buffer
+		proc.Stderr = &stderr
+		err = proc.Run()
+		return exitCode(c, err), stderr.String()
+	}
+	status, stderr := run("target: staging\n", "target-add", "prod", server.URL, "-s")
+	c.Assert(status, check.Equals, 0, check.Commentf(stderr))
+	c.Assert(stderr, check.Equals, "")
+	status, stderr = run("target: staging\n", "target-list")
+	c.Assert(status, check.Equals, 0, check.Commentf(stderr))
+	c.Assert(stderr, check.Equals, "")
+	status, stderr = run("target: [prod\n", "team-list")
+	c.Assert(status, check.Equals, 0, check.Commentf(stderr))
+	c.Assert(stderr, check.Matches, `WARNING: ignoring the project file: invalid project file .*/\.tsuru\.yaml: .*\n`)
+	status, stderr = run("target: staging\n", "team-list")
+	c.Assert(status, check.Equals, 1)
+	c.Assert(stderr, check.Matches, `Error: the target "staging" of the project file .*/\.tsuru\.yaml is not in the target list, add it with target-add\n`)
+}
+
+func (s *S) TestNonInteractive(c *check.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+	run := func(env string, args ...string) (int, string) {
+		proc := managerCommand(server.URL, args...)
+		proc.Env = append(proc.Env, env)
+		var stderr bytes.Buffer
+		proc.Stderr = &stderr
+		err := proc.Run()
+		return exitCode(c, err), stderr.String()
+	}
+	status, stderr := run("TSURU_NON_INTERACTIVE=no", "team-list")
+	c.Assert(status, check.Equals, 2)
+	c.Assert(stderr, check.Equals, "invalid value for TSURU_NON_INTERACTIVE: \"no\", expected true or false\n")
+	status, stderr = run("TSURU_NON_INTERACTIVE=false", "team-list")
+	c.Assert(status, check.Equals, 0, check.Commentf(stderr))
+	status, stderr = run("TSURU_NON_INTERACTIVE=true", "app-remove", "-a", "myapp")
+	c.Assert(status, check.Equals, 1)
+	c.Assert(stderr, check.Equals, "Error: unable to ask \"Are you sure you want to remove app \\\"myapp\\\"?\" in non-interactive mode, use -y to answer it\n")
+}